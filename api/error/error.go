@@ -8,4 +8,13 @@ var (
 	ErrEmptySourcePath        = errors.New("source path must not be empty")
 	ErrTraceAlreadyRunning    = errors.New("trace with given sourcePath is running already")
 	ErrHeapProcAlreadyRunning = errors.New("heap profile processing with given sourcePath is running already")
+	ErrNegativeID             = errors.New("id must not be negative")
+	ErrItemNotFound           = errors.New("no item with given id")
+	ErrUnknownRanking         = errors.New("unknown goroutine ranking")
+	ErrInvalidFilter          = errors.New("invalid goroutine filter")
+	ErrGoroutineNotFound      = errors.New("goroutine not found")
+	ErrStackNotFound          = errors.New("stack not found")
+	ErrUnknownStackFormat     = errors.New("unknown stack format")
+	ErrUnknownProfileType     = errors.New("unknown profile type")
+	ErrNoRawTrace             = errors.New("no complete trace generations recorded yet")
 )
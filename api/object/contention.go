@@ -0,0 +1,17 @@
+package object
+
+import "time"
+
+// ContentionSite is a place where goroutines block on a mutex, a channel operation or a select statement
+type ContentionSite struct {
+	Reason string `json:"reason"`
+	// Stack is the stack at the moment of blocking
+	Stack string `json:"stack"`
+	// TotalWait includes waits of goroutines blocked at the site now
+	TotalWait time.Duration `json:"total-wait"`
+	// Waiters is a number of waits at the site, a goroutine blocked several times is counted every time
+	Waiters int64         `json:"waiters"`
+	MaxWait time.Duration `json:"max-wait"`
+	// Blocked is a number of goroutines waiting at the site now
+	Blocked int `json:"blocked"`
+}
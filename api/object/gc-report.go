@@ -0,0 +1,54 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// GCReport describes garbage collector activity within a time window
+	GCReport struct {
+		Window         time.Duration               `json:"window"`
+		Cycles         []GCCycle                   `json:"cycles"`
+		Pauses         LatencyHistogram            `json:"pauses"`
+		PausesByReason map[string]LatencyHistogram `json:"pauses-by-reason"`
+		// MarkAssistDuration is time spent by goroutines helping GC mark within the window
+		MarkAssistDuration time.Duration   `json:"mark-assist-duration"`
+		SweepDuration      time.Duration   `json:"sweep-duration"`
+		BytesSwept         uint64          `json:"bytes-swept"`
+		BytesReclaimed     uint64          `json:"bytes-reclaimed"`
+		CPUFraction        []GCCPUFraction `json:"cpu-fraction"`
+		// TopLifetimeMarkAssists contains goroutines which have spent most time in mark assist over their lifetime,
+		// it doesn't depend on the window
+		TopLifetimeMarkAssists []GoroutineMarkAssist `json:"top-lifetime-mark-assists"`
+	}
+
+	GCCycle struct {
+		Number       int           `json:"number"`
+		Start        trace.Time    `json:"start"`
+		MarkDuration time.Duration `json:"mark-duration"` // zero if the mark phase is still in progress
+		Pauses       []GCPause     `json:"pauses"`
+	}
+
+	GCPause struct {
+		Start    trace.Time    `json:"start"`
+		Reason   string        `json:"reason"`
+		Duration time.Duration `json:"duration"`
+	}
+
+	// GCCPUFraction is an estimated fraction of CPU time used by GC within a time interval starting at Time
+	GCCPUFraction struct {
+		Time       trace.Time    `json:"time"`
+		Interval   time.Duration `json:"interval"`
+		GOMAXPROCS int           `json:"gomaxprocs"`
+		Fraction   float64       `json:"fraction"`
+	}
+
+	GoroutineMarkAssist struct {
+		ID              trace.GoID    `json:"id"`
+		Stack           string        `json:"stack"`
+		TransitionStack string        `json:"transition-stack"`
+		Duration        time.Duration `json:"duration"`
+	}
+)
@@ -0,0 +1,21 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+// GoroutineGroup aggregates goroutines having identical stack and transition stack
+type GoroutineGroup struct {
+	Stack           string         `json:"stack"`
+	TransitionStack string         `json:"transition-stack"`
+	Count           int            `json:"count"`
+	States          map[string]int `json:"states"` // number of goroutines in every state
+	ExecDuration    time.Duration  `json:"execution-duration"`
+	IdleDuration    time.Duration  `json:"idle-duration"`
+	// WaitDurations is time spent by all goroutines of the group in Waiting and Syscall states by wait reasons
+	WaitDurations    map[string]time.Duration `json:"wait-durations"`
+	RunnableDuration time.Duration            `json:"runnable-duration"`
+	SampleIDs        []trace.GoID             `json:"sample-ids"` // IDs of a few goroutines from the group
+}
@@ -0,0 +1,20 @@
+package object
+
+import "time"
+
+// GoroutineLeak describes a group of long-living goroutines created at the same place
+type GoroutineLeak struct {
+	CreationStack   string            `json:"creation-stack"`
+	CreationSeen    bool              `json:"creation-seen"` // false if goroutines were created before tracing started
+	Count           int               `json:"count"`
+	GrowthPerMinute float64           `json:"growth-per-minute"`
+	Growth          []LeakGrowthPoint `json:"growth"`
+	OldestAge       time.Duration     `json:"oldest-age"`
+	Oldest          TopGoroutine      `json:"oldest"`
+}
+
+// LeakGrowthPoint is the number of the group's goroutines which had already existed Ago time back
+type LeakGrowthPoint struct {
+	Ago   time.Duration `json:"ago"`
+	Count int           `json:"count"`
+}
@@ -0,0 +1,33 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// GoroutineSeries describes how numbers of goroutines in every state have changed within a time window
+	GoroutineSeries struct {
+		Window     time.Duration         `json:"window"`
+		Resolution time.Duration         `json:"resolution"`
+		Points     []GoroutineCountPoint `json:"points"`
+	}
+
+	// GoroutineCountPoint contains numbers of goroutines in every state at the end of the interval and numbers of
+	// goroutines created and terminated within the interval
+	GoroutineCountPoint struct {
+		Time     trace.Time    `json:"time"`
+		Interval time.Duration `json:"interval"`
+		// Living is a number of goroutines being in any of the states below
+		Living   int `json:"living"`
+		Running  int `json:"running"`
+		Runnable int `json:"runnable"`
+		Waiting  int `json:"waiting"`
+		Syscall  int `json:"syscall"`
+		// MaxRunnable is a maximum number of goroutines waiting for a P simultaneously within the interval
+		MaxRunnable int `json:"max-runnable"`
+		Created     int `json:"created"`
+		Terminated  int `json:"terminated"`
+	}
+)
@@ -0,0 +1,48 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// GoroutineTimeline is a lifecycle of a single goroutine
+	GoroutineTimeline struct {
+		Goroutine TopGoroutine `json:"goroutine"`
+		State     string       `json:"state"`
+		// Created is true if the goroutine creation has been observed, otherwise FirstSeen is the time the goroutine
+		// showed up in the trace
+		Created   bool       `json:"created"`
+		FirstSeen trace.Time `json:"first-seen"`
+		// Transitions contains the latest state transitions, DroppedTransitions is a number of older ones which are
+		// not kept anymore
+		Transitions        []GoroutineTransition `json:"transitions"`
+		DroppedTransitions int                   `json:"dropped-transitions"`
+		// RunSlices contains intervals the goroutine was running within the kept transitions
+		RunSlices []RunSlice `json:"run-slices"`
+		// BlockingSites contains the latest distinct stacks the goroutine has blocked at, the newest is the last one
+		BlockingSites      []string       `json:"blocking-sites,omitempty"`
+		BlockingSiteIDs    []int          `json:"blocking-site-ids"`
+		BlockingSiteFrames [][]StackFrame `json:"blocking-site-frames,omitempty"`
+	}
+
+	GoroutineTransition struct {
+		Time        trace.Time   `json:"time"`
+		From        string       `json:"from"`
+		To          string       `json:"to"`
+		Reason      string       `json:"reason,omitempty"`
+		Stack       string       `json:"stack,omitempty"`
+		StackID     int          `json:"stack-id,omitempty"`
+		StackFrames []StackFrame `json:"stack-frames,omitempty"`
+	}
+
+	RunSlice struct {
+		Start    trace.Time    `json:"start"`
+		End      trace.Time    `json:"end"`
+		Duration time.Duration `json:"duration"`
+		Proc     trace.ProcID  `json:"proc"`
+		// Ongoing is true if the goroutine is still running, End is the time of the last event then
+		Ongoing bool `json:"ongoing,omitempty"`
+	}
+)
@@ -0,0 +1,35 @@
+package object
+
+import "time"
+
+type (
+	// LatencyHistogram is a distribution of latencies. Percentiles are approximate, they are upper bounds of the
+	// buckets they fall into
+	LatencyHistogram struct {
+		Count   int64           `json:"count"`
+		Mean    time.Duration   `json:"mean"`
+		P50     time.Duration   `json:"p50"`
+		P90     time.Duration   `json:"p90"`
+		P99     time.Duration   `json:"p99"`
+		Max     time.Duration   `json:"max"`
+		Buckets []LatencyBucket `json:"buckets"` // non-empty buckets only
+	}
+
+	LatencyBucket struct {
+		UpperBound time.Duration `json:"upper-bound"`
+		Count      int64         `json:"count"`
+	}
+
+	// SchedLatency describes delays between a goroutine becoming runnable and starting running
+	SchedLatency struct {
+		Window time.Duration       `json:"window"`
+		Global LatencyHistogram    `json:"global"`
+		Groups []GroupSchedLatency `json:"groups"` // sorted by p99 in descending order
+	}
+
+	GroupSchedLatency struct {
+		Stack           string           `json:"stack"`
+		TransitionStack string           `json:"transition-stack"`
+		Histogram       LatencyHistogram `json:"histogram"`
+	}
+)
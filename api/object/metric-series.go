@@ -0,0 +1,14 @@
+package object
+
+import "golang.org/x/exp/trace"
+
+// MetricSeries is a time series of a runtime metric sampled by the execution tracer, e.g. "/gc/heap/goal:bytes"
+type MetricSeries struct {
+	Name   string        `json:"name"`
+	Points []MetricPoint `json:"points"`
+}
+
+type MetricPoint struct {
+	Time  trace.Time `json:"time"`
+	Value uint64     `json:"value"`
+}
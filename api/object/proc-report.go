@@ -0,0 +1,46 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// ProcReport describes how Ps (logical processors) and OS threads were used within a time window
+	ProcReport struct {
+		Window     time.Duration `json:"window"`
+		GOMAXPROCS int           `json:"gomaxprocs"`
+		// Utilization is a fraction of time Ps were running within the window against GOMAXPROCS
+		Utilization float64                `json:"utilization"`
+		Procs       []ProcTimeline         `json:"procs"`
+		Series      []ProcUtilizationPoint `json:"series"`
+	}
+
+	ProcTimeline struct {
+		ID           trace.ProcID  `json:"id"`
+		State        string        `json:"state"`
+		BusyDuration time.Duration `json:"busy-duration"`
+		Utilization  float64       `json:"utilization"`
+		Busy         []TimeRange   `json:"busy"` // the latest intervals of running
+	}
+
+	TimeRange struct {
+		Start trace.Time `json:"start"`
+		End   trace.Time `json:"end"`
+	}
+
+	ProcUtilizationPoint struct {
+		Time        trace.Time    `json:"time"`
+		Interval    time.Duration `json:"interval"`
+		GOMAXPROCS  int           `json:"gomaxprocs"`
+		Utilization float64       `json:"utilization"`
+		// Threads is a number of distinct OS threads seen within the interval
+		Threads int `json:"threads"`
+		// MaxSyscalls is a maximum number of goroutines being in syscalls simultaneously
+		MaxSyscalls int `json:"max-syscalls"`
+		// ProcSteals is a number of Ps taken away from threads blocked in syscalls, every steal makes the runtime
+		// run the P on another thread
+		ProcSteals int `json:"proc-steals"`
+	}
+)
@@ -0,0 +1,33 @@
+package object
+
+import "time"
+
+type (
+	// ProcessState describes the trace source of a trace process and its connection history
+	ProcessState struct {
+		SourcePath string `json:"source-path"`
+		Connected  bool   `json:"connected"`
+		// Streams is a number of trace streams read from the source, it is greater than one after reconnects
+		Streams int    `json:"streams"`
+		Error   string `json:"error,omitempty"`
+		// DisconnectedAt and DisconnectReason describe the current gap if the source is not connected now
+		DisconnectedAt   time.Time `json:"disconnected-at,omitzero"`
+		DisconnectReason string    `json:"disconnect-reason,omitempty"`
+		// Reconnects contains the latest reconnects, the oldest ones are dropped when there are too many of them
+		Reconnects      []StreamReconnect `json:"reconnects"`
+		TotalReconnects int               `json:"total-reconnects"`
+	}
+
+	// StreamReconnect describes a gap between two trace streams
+	StreamReconnect struct {
+		DisconnectedAt time.Time `json:"disconnected-at"`
+		ReconnectedAt  time.Time `json:"reconnected-at"`
+		// Gap is wall time without a stream
+		Gap time.Duration `json:"gap"`
+		// TraceGap is trace time between the last event of the previous stream and the first event of the new one
+		TraceGap time.Duration `json:"trace-gap"`
+		Reason   string        `json:"reason"`
+		// Restarted is true if the new stream comes from another process, e.g. the target has been restarted
+		Restarted bool `json:"restarted"`
+	}
+)
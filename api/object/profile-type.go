@@ -0,0 +1,15 @@
+package object
+
+// ProfileType is a kind of goroutine time or CPU samples pprof profiles are built of
+type ProfileType string
+
+const (
+	// ProfileExec is time goroutines have been running
+	ProfileExec ProfileType = "exec"
+	// ProfileIdle is time living goroutines have been idle since they stopped running
+	ProfileIdle ProfileType = "idle"
+	// ProfileWait is time goroutines have spent in Waiting and Syscall states by wait reasons
+	ProfileWait ProfileType = "wait"
+	// ProfileCPU is CPU samples of the trace, they are recorded while CPU profiling is enabled in the target
+	ProfileCPU ProfileType = "cpu"
+)
@@ -0,0 +1,35 @@
+package object
+
+type (
+	// SpawnTree shows which creation sites spawn goroutines of which other creation sites
+	SpawnTree struct {
+		Nodes []SpawnNode `json:"nodes"`
+		Edges []SpawnEdge `json:"edges"`
+	}
+
+	// SpawnNode is a creation site: the stack of the go statement and the stack the goroutines start with
+	SpawnNode struct {
+		ID              int    `json:"id"`
+		Function        string `json:"function"`
+		Stack           string `json:"stack"`
+		TransitionStack string `json:"transition-stack"`
+		// Living and Terminated count goroutines of the site spawned by known parents
+		Living     int `json:"living"`
+		Terminated int `json:"terminated"`
+		// Depth is the shortest distance from a site which isn't spawned by other sites
+		Depth int `json:"depth"`
+	}
+
+	// SpawnEdge contains goroutines of the Child site spawned by goroutines of the Parent site
+	SpawnEdge struct {
+		Parent     int `json:"parent"`
+		Child      int `json:"child"`
+		Living     int `json:"living"`
+		Terminated int `json:"terminated"`
+		// Parents is a number of parent goroutines which have spawned children, MeanFanOut and MaxFanOut are numbers
+		// of children per such a parent
+		Parents    int     `json:"parents"`
+		MeanFanOut float64 `json:"mean-fan-out"`
+		MaxFanOut  int     `json:"max-fan-out"`
+	}
+)
@@ -0,0 +1,31 @@
+package object
+
+// StackFormat tells how stacks are returned in responses
+type StackFormat string
+
+const (
+	// StackFormatRendered returns stacks formatted like goroutine dumps do
+	StackFormatRendered StackFormat = "rendered"
+	// StackFormatStructured returns stacks as lists of frames
+	StackFormatStructured StackFormat = "structured"
+	// StackFormatID returns stack ids only, stacks can be requested by their ids separately
+	StackFormatID StackFormat = "id"
+)
+
+type (
+	// Stack is an interned stack, its id is unique within a trace process
+	Stack struct {
+		ID       int          `json:"id"`
+		Frames   []StackFrame `json:"frames"`
+		Rendered string       `json:"rendered"`
+	}
+
+	// StackFrame is a single frame of a stack, the innermost frame goes first
+	StackFrame struct {
+		Function string `json:"function"`
+		Package  string `json:"package"`
+		File     string `json:"file"`
+		Line     uint64 `json:"line"`
+		PC       uint64 `json:"pc"`
+	}
+)
@@ -1,16 +1,69 @@
 package object
 
 import (
+	"encoding/json"
 	"time"
 
 	"golang.org/x/exp/trace"
 )
 
+// RankBy is a goroutine statistic goroutines are ranked by
+type RankBy string
+
+const (
+	RankByExec RankBy = "exec"
+	RankByIdle RankBy = "idle"
+	// RankBySchedLatency ranks by total time between becoming runnable and starting running
+	RankBySchedLatency RankBy = "sched-latency"
+	// RankByBlocks ranks by a number of times a goroutine has blocked
+	RankByBlocks   RankBy = "blocks"
+	RankByLifetime RankBy = "lifetime"
+)
+
+// TopGoroutine describes a goroutine. Its stacks are rendered, structured or only referenced by ids depending on the
+// requested StackFormat
 type TopGoroutine struct {
-	ID              trace.GoID    `json:"id"`
-	Stack           string        `json:"stack"`
-	TransitionStack string        `json:"transition-stack"`
-	ExecDuration    time.Duration `json:"execution-duration"`
-	IdleDuration    time.Duration `json:"idle-duration"`
-	InvokedBy       *TopGoroutine `json:"invoked-by,omitempty"`
+	ID                    trace.GoID   `json:"id"`
+	Stack                 string       `json:"stack"`
+	StackID               int          `json:"stack-id"`
+	StackFrames           []StackFrame `json:"stack-frames,omitempty"`
+	TransitionStack       string       `json:"transition-stack"`
+	TransitionStackID     int          `json:"transition-stack-id"`
+	TransitionStackFrames []StackFrame `json:"transition-stack-frames,omitempty"`
+	// BlockingStack is the stack where the goroutine has blocked at the last time, the stacks above are the ones
+	// it has been created with
+	BlockingStack       string        `json:"blocking-stack,omitempty"`
+	BlockingStackID     int           `json:"blocking-stack-id,omitempty"`
+	BlockingStackFrames []StackFrame  `json:"blocking-stack-frames,omitempty"`
+	ExecDuration        time.Duration `json:"execution-duration"`
+	IdleDuration        time.Duration `json:"idle-duration"`
+	// WaitReason is a reason of the current Waiting or Syscall state, e.g. "chan receive", "network", "sync.Mutex"
+	WaitReason string `json:"wait-reason,omitempty"`
+	// WaitDurations is time spent in Waiting and Syscall states by wait reasons
+	WaitDurations      map[string]time.Duration `json:"wait-durations,omitempty"`
+	RunnableDuration   time.Duration            `json:"runnable-duration"`
+	MarkAssistDuration time.Duration            `json:"mark-assist-duration,omitempty"`
+	SchedLatency       time.Duration            `json:"sched-latency"`
+	BlockCount         int                      `json:"block-count"`
+	// Lifetime is time since the goroutine was first seen up to the last event or the goroutine's termination
+	Lifetime time.Duration `json:"lifetime"`
+	// Evicted is true if the goroutine's stats have been rolled into its group's totals, its durations may be stale
+	Evicted   bool          `json:"evicted,omitempty"`
+	InvokedBy *TopGoroutine `json:"invoked-by,omitempty"`
+	// StackFormat is the format stacks have been converted to, empty for rendered stacks
+	StackFormat StackFormat `json:"-"`
+}
+
+// MarshalJSON leaves rendered stacks out if stacks have been converted to structured ones or ids
+func (g TopGoroutine) MarshalJSON() ([]byte, error) {
+	type plain TopGoroutine
+	if g.StackFormat != StackFormatStructured && g.StackFormat != StackFormatID {
+		return json.Marshal(plain(g))
+	}
+
+	return json.Marshal(struct {
+		plain
+		Stack           string `json:"stack,omitempty"`
+		TransitionStack string `json:"transition-stack,omitempty"`
+	}{plain: plain(g)})
 }
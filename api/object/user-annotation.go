@@ -0,0 +1,39 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// TaskStat describes user tasks (runtime/trace.NewTask) of the same type
+	TaskStat struct {
+		Type      string           `json:"type"`
+		Completed int64            `json:"completed"`
+		Active    int              `json:"active"`
+		Latency   LatencyHistogram `json:"latency"`
+		Regions   []RegionStat     `json:"regions"`
+	}
+
+	// RegionStat describes user regions (runtime/trace.WithRegion) of the same type within tasks of the same type
+	RegionStat struct {
+		Type             string        `json:"type"`
+		Count            int64         `json:"count"`
+		Duration         time.Duration `json:"duration"`
+		RunningDuration  time.Duration `json:"running-duration"`
+		WaitingDuration  time.Duration `json:"waiting-duration"`
+		RunnableDuration time.Duration `json:"runnable-duration"`
+		SyscallDuration  time.Duration `json:"syscall-duration"`
+	}
+
+	// LogEntry is a message logged by runtime/trace.Log
+	LogEntry struct {
+		Time        trace.Time   `json:"time"`
+		TaskID      trace.TaskID `json:"task-id"`
+		TaskType    string       `json:"task-type"`
+		GoroutineID trace.GoID   `json:"goroutine-id"`
+		Category    string       `json:"category"`
+		Message     string       `json:"message"`
+	}
+)
@@ -0,0 +1,38 @@
+package object
+
+import "time"
+
+type (
+	// WakeGraph shows which goroutine groups make goroutines of which other groups runnable, e.g. producers waking
+	// consumers up by sending to channels or unlocking mutexes
+	WakeGraph struct {
+		Nodes []WakeNode `json:"nodes"`
+		Edges []WakeEdge `json:"edges"`
+	}
+
+	// WakeNode is a goroutine group. The node without stacks stands for the runtime waking goroutines up without
+	// a running goroutine, e.g. when timers fire or network connections become ready
+	WakeNode struct {
+		ID              int    `json:"id"`
+		Function        string `json:"function"`
+		Stack           string `json:"stack,omitempty"`
+		TransitionStack string `json:"transition-stack,omitempty"`
+		// Wakes is a number of times goroutines of the group have woken other goroutines up, Woken is a number of
+		// times goroutines of the group have been woken up
+		Wakes int64 `json:"wakes"`
+		Woken int64 `json:"woken"`
+	}
+
+	// WakeEdge contains wake-ups of goroutines of the Wakee group by goroutines of the Waker group
+	WakeEdge struct {
+		Waker int   `json:"waker"`
+		Wakee int   `json:"wakee"`
+		Count int64 `json:"count"`
+		// MeanWait and MaxWait are time wakees have been blocked before being woken up
+		MeanWait time.Duration `json:"mean-wait"`
+		MaxWait  time.Duration `json:"max-wait"`
+		// MeanLatency and MaxLatency are time between being woken up and starting running
+		MeanLatency time.Duration `json:"mean-latency"`
+		MaxLatency  time.Duration `json:"max-latency"`
+	}
+)
@@ -4,7 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"golang.org/x/exp/trace"
 
 	apiError "github.com/maratig/trace_analyzer/api/error"
 	"github.com/maratig/trace_analyzer/api/object"
@@ -118,19 +123,371 @@ func (a *App) ProcessHeapSource(ctx context.Context, sourcePath string) (int, er
 	return len(a.heapProcesses) - 1, nil
 }
 
-// TopIdlingGoroutines returns the top n inactive goroutines
-func (a *App) TopIdlingGoroutines(ctx context.Context, id int) ([]object.TopGoroutine, error) {
+// TopIdlingGoroutines returns the top n inactive goroutines, only goroutines matching the filter are returned if it is
+// not empty
+func (a *App) TopIdlingGoroutines(ctx context.Context, id int, filter string) ([]object.TopGoroutine, error) {
 	if ctx == nil {
 		return nil, apiError.ErrNilContext
 	}
-	if id < 0 {
-		return nil, errors.New("id must not be negative")
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
 	}
-	if len(a.traceProcesses) == 0 || id >= len(a.traceProcesses) {
-		return nil, errors.New("no item with given id")
+
+	if filter != "" {
+		return tp.TopGoroutines(object.RankByIdle, 0, false, filter)
+	}
+	return tp.TopIdlingGoroutines(), nil
+}
+
+// TopGoroutines returns limit living goroutines matching the filter ranked by the given statistic in descending order
+// unless ascending is true
+func (a *App) TopGoroutines(
+	ctx context.Context, id int, by object.RankBy, limit int, ascending bool, filter string,
+) ([]object.TopGoroutine, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.TopGoroutines(by, limit, ascending, filter)
+}
+
+// Goroutines returns living and terminated goroutines matching the filter expression, e.g.
+// `idle > 30s and stack ~ "database/sql"`
+func (a *App) Goroutines(ctx context.Context, id int, filter string, limit int) ([]object.TopGoroutine, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.Goroutines(filter, limit)
+}
+
+// GoroutineTimeline returns state transitions and run slices of a single goroutine
+func (a *App) GoroutineTimeline(ctx context.Context, id int, gID trace.GoID) (object.GoroutineTimeline, error) {
+	if ctx == nil {
+		return object.GoroutineTimeline{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.GoroutineTimeline{}, err
+	}
+
+	return tp.GoroutineTimeline(gID)
+}
+
+// ContentionSites returns limit places where goroutines have spent the most time blocked on mutexes, channel operations
+// and select statements
+func (a *App) ContentionSites(ctx context.Context, id int, limit int) ([]object.ContentionSite, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.ContentionSites(limit), nil
+}
+
+// Stack returns an interned stack by its id
+func (a *App) Stack(ctx context.Context, id int, stackID int) (object.Stack, error) {
+	if ctx == nil {
+		return object.Stack{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.Stack{}, err
+	}
+
+	return tp.Stack(stackID)
+}
+
+// FormatStacks converts rendered stacks of the goroutines returned by the trace process of the given id to the format
+func (a *App) FormatStacks(ctx context.Context, id int, format object.StackFormat, gors []object.TopGoroutine) error {
+	if ctx == nil {
+		return apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return err
+	}
+
+	return tp.FormatStacks(format, gors)
+}
+
+// FormatTimelineStacks converts rendered stacks of the goroutine timeline to the format
+func (a *App) FormatTimelineStacks(
+	ctx context.Context, id int, format object.StackFormat, timeline *object.GoroutineTimeline,
+) error {
+	if ctx == nil {
+		return apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return err
+	}
+
+	return tp.FormatTimelineStacks(format, timeline)
+}
+
+// WriteProfile writes a gzipped pprof profile of goroutine time or CPU samples of the given type to w. CPU samples are
+// taken within the given time window, all kept samples are used if window is not positive
+func (a *App) WriteProfile(
+	ctx context.Context, id int, typ object.ProfileType, window time.Duration, w io.Writer,
+) error {
+	prof, err := a.profile(ctx, id, typ, window)
+	if err != nil {
+		return err
+	}
+	return prof.Write(w)
+}
+
+// WriteFoldedStacks writes a profile of the given type to w as folded stacks for flame graph tools, see WriteProfile
+func (a *App) WriteFoldedStacks(
+	ctx context.Context, id int, typ object.ProfileType, window time.Duration, w io.Writer,
+) error {
+	prof, err := a.profile(ctx, id, typ, window)
+	if err != nil {
+		return err
+	}
+	return traceProcess.WriteFoldedStacks(prof, w)
+}
+
+func (a *App) profile(
+	ctx context.Context, id int, typ object.ProfileType, window time.Duration,
+) (*profile.Profile, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.Profile(typ, window)
+}
+
+// SpawnTree returns creation sites of goroutines linked by spawning
+func (a *App) SpawnTree(ctx context.Context, id int) (object.SpawnTree, error) {
+	if ctx == nil {
+		return object.SpawnTree{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.SpawnTree{}, err
+	}
+
+	return tp.SpawnTree(), nil
+}
+
+// WriteSpawnTreeDOT writes the spawn tree of the given id to w in Graphviz DOT format
+func (a *App) WriteSpawnTreeDOT(ctx context.Context, id int, w io.Writer) error {
+	tree, err := a.SpawnTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return traceProcess.WriteSpawnTreeDOT(w, tree)
+}
+
+// WakeGraph returns goroutine groups linked by waking goroutines up
+func (a *App) WakeGraph(ctx context.Context, id int) (object.WakeGraph, error) {
+	if ctx == nil {
+		return object.WakeGraph{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.WakeGraph{}, err
+	}
+
+	return tp.WakeGraph(), nil
+}
+
+// WriteWakeGraphDOT writes the wake graph of the given id to w in Graphviz DOT format
+func (a *App) WriteWakeGraphDOT(ctx context.Context, id int, w io.Writer) error {
+	graph, err := a.WakeGraph(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return traceProcess.WriteWakeGraphDOT(w, graph)
+}
+
+// GoroutineLeaks returns groups of goroutines living longer than threshold. If threshold is not positive, the default
+// one is used
+func (a *App) GoroutineLeaks(ctx context.Context, id int, threshold time.Duration) ([]object.GoroutineLeak, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.GoroutineLeaks(threshold), nil
+}
+
+// GoroutineGroups returns goroutines aggregated by identical stacks. Terminated goroutines are included if
+// withTerminated is true
+func (a *App) GoroutineGroups(ctx context.Context, id int, withTerminated bool) ([]object.GoroutineGroup, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.GoroutineGroups(withTerminated), nil
+}
+
+// SchedLatency returns distributions of goroutine scheduling delays within the given time window. If window is not
+// positive, all collected data is used
+func (a *App) SchedLatency(ctx context.Context, id int, window time.Duration) (object.SchedLatency, error) {
+	if ctx == nil {
+		return object.SchedLatency{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.SchedLatency{}, err
+	}
+
+	return tp.SchedLatency(window), nil
+}
+
+// GCReport returns GC cycles, pauses and CPU usage within the given time window. If window is not positive, all
+// collected data is used
+func (a *App) GCReport(ctx context.Context, id int, window time.Duration) (object.GCReport, error) {
+	if ctx == nil {
+		return object.GCReport{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.GCReport{}, err
 	}
 
-	return a.traceProcesses[id].TopIdlingGoroutines(), nil
+	return tp.GCReport(window), nil
+}
+
+// Metrics returns time series of runtime metrics with the given names within the given time window. All metrics are
+// returned if names is empty, all collected points are returned if window is not positive
+func (a *App) Metrics(
+	ctx context.Context, id int, names []string, window time.Duration,
+) ([]object.MetricSeries, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.Metrics(names, window), nil
+}
+
+// ProcReport returns utilization of Ps and OS threads within the given time window. If window is not positive, all
+// collected data is used
+func (a *App) ProcReport(ctx context.Context, id int, window time.Duration) (object.ProcReport, error) {
+	if ctx == nil {
+		return object.ProcReport{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.ProcReport{}, err
+	}
+
+	return tp.ProcReport(window), nil
+}
+
+// GoroutineSeries returns numbers of goroutines in every state along with creations and terminations over the given
+// time window. If window is not positive, all collected points are returned
+func (a *App) GoroutineSeries(ctx context.Context, id int, window time.Duration) (object.GoroutineSeries, error) {
+	if ctx == nil {
+		return object.GoroutineSeries{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.GoroutineSeries{}, err
+	}
+
+	return tp.GoroutineSeries(window), nil
+}
+
+// Tasks returns statistics of user tasks and regions by task types. Task latencies are calculated within the given
+// time window, if window is not positive all collected data is used
+func (a *App) Tasks(ctx context.Context, id int, window time.Duration) ([]object.TaskStat, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.Tasks(window), nil
+}
+
+// Logs returns user log entries of the given category whose messages contain the given substring. Empty category and
+// substring match any entry, if limit is positive at most limit newest entries are returned
+func (a *App) Logs(ctx context.Context, id int, category, contains string, limit int) ([]object.LogEntry, error) {
+	if ctx == nil {
+		return nil, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tp.Logs(category, contains, limit), nil
+}
+
+// TraceState returns the state of the trace source of the given id including reconnects and gaps between streams
+func (a *App) TraceState(ctx context.Context, id int) (object.ProcessState, error) {
+	if ctx == nil {
+		return object.ProcessState{}, apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return object.ProcessState{}, err
+	}
+
+	return tp.State(), nil
+}
+
+// WriteRawTrace writes the latest window of the raw trace of the given id to w, the result can be opened by
+// go tool trace
+func (a *App) WriteRawTrace(ctx context.Context, id int, w io.Writer) error {
+	if ctx == nil {
+		return apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return err
+	}
+
+	return tp.WriteRawTrace(w)
+}
+
+// WriteChromeTrace writes the latest window of the raw trace of the given id to w as Chrome trace-event JSON, the
+// result can be opened by Perfetto UI
+func (a *App) WriteChromeTrace(ctx context.Context, id int, w io.Writer) error {
+	if ctx == nil {
+		return apiError.ErrNilContext
+	}
+	tp, err := a.getTraceProcess(id)
+	if err != nil {
+		return err
+	}
+
+	return tp.WriteChromeTrace(w)
 }
 
 // HeapProfilesSummary returns summaries for all collected heap profiles by the given id
@@ -148,3 +505,19 @@ func (a *App) HeapProfilesSummary(ctx context.Context, id int) ([][]object.HeapP
 
 	return a.heapProcesses[id].HeapProfilesSummary()
 }
+
+// getTraceProcess returns a trace process by the given id
+func (a *App) getTraceProcess(id int) (*traceProcess.TraceProcess, error) {
+	if id < 0 {
+		return nil, apiError.ErrNegativeID
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if len(a.traceProcesses) == 0 || id >= len(a.traceProcesses) {
+		return nil, apiError.ErrItemNotFound
+	}
+
+	return a.traceProcesses[id], nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/maratig/trace_analyzer/internal/helper"
+	traceProcess "github.com/maratig/trace_analyzer/internal/service/trace_process"
+)
+
+const (
+	exportConnectInterval = time.Second
+	exportConnectionWait  = 10 * time.Second
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <source_path>",
+	Short: "Convert a trace file or a trace stream from an endpoint to Chrome trace-event JSON for Perfetto UI",
+	Long: "Convert a trace file or a trace stream from an endpoint to Chrome trace-event JSON for Perfetto UI. " +
+		"A stream is read until it ends or the command is interrupted",
+	Args: cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		ctx, _ := signal.NotifyContext(context.Background(), os.Kill, os.Interrupt)
+		cmd.SetContext(ctx)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse output; %v", err))
+		}
+
+		if err := exportChromeTrace(cmd.Context(), args[0], output); err != nil {
+			panic(fmt.Sprintf("export command failed; %v", err))
+		}
+	},
+}
+
+func initExportCmdFlags() {
+	exportCmd.Flags().StringP("output", "o", "", "File to write JSON to, stdout by default")
+}
+
+func exportChromeTrace(ctx context.Context, sourcePath, output string) error {
+	if ctx == nil {
+		return errors.New("ctx must not be nil")
+	}
+
+	r, closer, err := helper.CreateTraceReader(ctx, sourcePath, exportConnectInterval, exportConnectionWait, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create trace reader; %w", err)
+	}
+	defer closer.Close()
+	// Closing the source stops reading, and the JSON is completed with the events read so far
+	stop := context.AfterFunc(ctx, func() { closer.Close() })
+	defer stop()
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file; %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err = traceProcess.ConvertToChromeTrace(r, w); err != nil && ctx.Err() == nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+
+	return nil
+}
@@ -18,6 +18,8 @@ func init() {
 	rootCmd.AddCommand(analyzerCmd)
 	initExtTestAppCmdFlags()
 	rootCmd.AddCommand(extTestAppCmd)
+	initExportCmdFlags()
+	rootCmd.AddCommand(exportCmd)
 }
 
 func Execute() {
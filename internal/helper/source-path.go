@@ -17,8 +17,18 @@ import (
 
 const defaultHttpListeningSeconds = 36000
 
+// IsEndpoint returns true if sourcePath is an url rather than a local file
+func IsEndpoint(sourcePath string) bool {
+	u, err := url.Parse(sourcePath)
+	return err == nil && u.Host != ""
+}
+
+// CreateTraceReader creates a trace reader from a file or an url. Connecting to an url is retried every
+// endpointConnectInterval during endpointConnectionWait. If rawTap is not nil, all raw bytes read from the source are
+// written to it as well
 func CreateTraceReader(
-	ctx context.Context, sourcePath string, endpointConnectionWait time.Duration,
+	ctx context.Context, sourcePath string, endpointConnectInterval, endpointConnectionWait time.Duration,
+	rawTap io.Writer,
 ) (*trace.Reader, io.Closer, error) {
 	if ctx == nil {
 		return nil, nil, errors.New("ctx must not be nil")
@@ -26,14 +36,17 @@ func CreateTraceReader(
 	if sourcePath == "" {
 		return nil, nil, errors.New("sourcePath must not be empty")
 	}
+	if endpointConnectInterval <= 0 {
+		return nil, nil, errors.New("endpointConnectInterval must be greater than zero")
+	}
 	if endpointConnectionWait <= 0 {
 		return nil, nil, errors.New("endpointConnectionWait must be greater than zero")
 	}
 
 	// Check if sourcePath is a url
-	u, err := url.Parse(sourcePath)
-	if err == nil && u.Host != "" {
-		r, closer, err := createHttpReader(ctx, u, endpointConnectionWait)
+	if IsEndpoint(sourcePath) {
+		u, _ := url.Parse(sourcePath)
+		r, closer, err := createHttpReader(ctx, u, endpointConnectInterval, endpointConnectionWait, rawTap)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to create an http reader; %w", err)
 		}
@@ -45,7 +58,7 @@ func CreateTraceReader(
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open sourcePath as a file; %w", err)
 	}
-	r := bufio.NewReader(f)
+	r := bufio.NewReader(tap(f, rawTap))
 	ret, err := trace.NewReader(r)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create trace reader from file sourcePath; %w", err)
@@ -55,7 +68,7 @@ func CreateTraceReader(
 }
 
 func createHttpReader(
-	ctx context.Context, u *url.URL, endpointConnectionWait time.Duration,
+	ctx context.Context, u *url.URL, endpointConnectInterval, endpointConnectionWait time.Duration, rawTap io.Writer,
 ) (*trace.Reader, io.Closer, error) {
 	localCtx, cancel := context.WithTimeout(ctx, endpointConnectionWait)
 	defer cancel()
@@ -64,25 +77,43 @@ func createHttpReader(
 	params.Set("seconds", strconv.Itoa(defaultHttpListeningSeconds))
 	u.RawQuery = params.Encode()
 	urlStr := u.String()
+	var lastErr error
 	for {
 		if localCtx.Err() != nil {
+			if lastErr != nil {
+				return nil, nil, fmt.Errorf("failed to get response from the given url; %w", lastErr)
+			}
 			return nil, nil, localCtx.Err()
 		}
 
+		// The endpoint may be not ready yet or restarting, so both connection errors and server errors are retried
 		resp, err := http.Get(urlStr)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get response from the given url; %w", err)
+		if err == nil && resp.StatusCode >= 500 && resp.StatusCode < 600 {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected status %s", resp.Status)
 		}
-		if resp.StatusCode >= 500 && resp.StatusCode < 600 {
-			time.Sleep(5 * time.Millisecond)
+		if err != nil {
+			lastErr = err
+			select {
+			case <-localCtx.Done():
+			case <-time.After(endpointConnectInterval):
+			}
 			continue
 		}
 
-		r := bufio.NewReader(resp.Body)
+		r := bufio.NewReader(tap(resp.Body, rawTap))
 		ret, err := trace.NewReader(r)
 		if err != nil {
+			resp.Body.Close()
 			return nil, nil, fmt.Errorf("failed to create trace reader from url sourcePath; %w", err)
 		}
 		return ret, resp.Body, nil
 	}
 }
+
+func tap(r io.Reader, w io.Writer) io.Reader {
+	if w == nil {
+		return r
+	}
+	return io.TeeReader(r, w)
+}
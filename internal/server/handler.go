@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,14 +9,36 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
 
 	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
 	"github.com/maratig/trace_analyzer/app"
 )
 
 const (
 	sourcePathUrlParam = "source_path"
 	procIDParam        = "id"
+	goroutineIDParam   = "gid"
+	stackIDParam       = "sid"
+	thresholdParam     = "threshold"
+	terminatedParam    = "terminated"
+	windowParam        = "window"
+	nameParam          = "name"
+	limitParam         = "limit"
+	categoryParam      = "category"
+	containsParam      = "contains"
+	byParam            = "by"
+	ascendingParam     = "ascending"
+	filterParam        = "filter"
+	formatParam        = "format"
+	stacksParam        = "stacks"
+	typeParam          = "type"
+
+	dotFormat    = "dot"
+	foldedFormat = "folded"
 )
 
 type Handler struct {
@@ -125,41 +148,581 @@ func (h *Handler) HeapProfiles(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) TopIdlingGoroutines(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	top, err := h.app.TopIdlingGoroutines(h.ctx, id, r.FormValue(filterParam))
+	if err == nil {
+		err = h.app.FormatStacks(h.ctx, id, object.StackFormat(r.FormValue(stacksParam)), top)
+	}
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, top)
+}
+
+func (h *Handler) TopGoroutines(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	by := r.FormValue(byParam)
+	if by == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(byParam + " is required"))
+		return
+	}
+	limit, ok := getIntParam(w, r, limitParam)
+	if !ok {
+		return
+	}
+	ascending, ok := getBoolParam(w, r, ascendingParam)
+	if !ok {
+		return
+	}
+
+	top, err := h.app.TopGoroutines(h.ctx, id, object.RankBy(by), limit, ascending, r.FormValue(filterParam))
+	if err == nil {
+		err = h.app.FormatStacks(h.ctx, id, object.StackFormat(r.FormValue(stacksParam)), top)
+	}
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, top)
+}
+
+// Goroutines responds with living and terminated goroutines matching the filter
+func (h *Handler) Goroutines(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := getIntParam(w, r, limitParam)
+	if !ok {
+		return
+	}
+
+	gors, err := h.app.Goroutines(h.ctx, id, r.FormValue(filterParam), limit)
+	if err == nil {
+		err = h.app.FormatStacks(h.ctx, id, object.StackFormat(r.FormValue(stacksParam)), gors)
+	}
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, gors)
+}
+
+// GoroutineTimeline responds with the lifecycle of a single goroutine
+func (h *Handler) GoroutineTimeline(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	gID, err := strconv.ParseInt(r.PathValue(goroutineIDParam), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid " + goroutineIDParam))
+		return
+	}
+
+	timeline, err := h.app.GoroutineTimeline(h.ctx, id, trace.GoID(gID))
+	if err == nil {
+		err = h.app.FormatTimelineStacks(h.ctx, id, object.StackFormat(r.FormValue(stacksParam)), &timeline)
+	}
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, timeline)
+}
+
+// Stack responds with an interned stack as frames and a rendered string
+func (h *Handler) Stack(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	sID, err := strconv.Atoi(r.PathValue(stackIDParam))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid " + stackIDParam))
+		return
+	}
+
+	stack, err := h.app.Stack(h.ctx, id, sID)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, stack)
+}
+
+// ContentionSites responds with places where goroutines have been blocked the longest
+func (h *Handler) ContentionSites(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := getIntParam(w, r, limitParam)
+	if !ok {
+		return
+	}
+
+	sites, err := h.app.ContentionSites(h.ctx, id, limit)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, sites)
+}
+
+// SpawnTree responds with the spawn tree as JSON or, if the format parameter is "dot", in Graphviz DOT format
+func (h *Handler) SpawnTree(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.FormValue(formatParam) == dotFormat {
+		var buf bytes.Buffer
+		if err := h.app.WriteSpawnTreeDOT(h.ctx, id, &buf); err != nil {
+			writeAppError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	tree, err := h.app.SpawnTree(h.ctx, id)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, tree)
+}
+
+// WakeGraph responds with the wake graph as JSON or, if the format parameter is "dot", in Graphviz DOT format
+func (h *Handler) WakeGraph(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.FormValue(formatParam) == dotFormat {
+		var buf bytes.Buffer
+		if err := h.app.WriteWakeGraphDOT(h.ctx, id, &buf); err != nil {
+			writeAppError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	graph, err := h.app.WakeGraph(h.ctx, id)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, graph)
+}
+
+func (h *Handler) GoroutineLeaks(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	threshold, ok := getDurationParam(w, r, thresholdParam)
+	if !ok {
+		return
+	}
+
+	leaks, err := h.app.GoroutineLeaks(h.ctx, id, threshold)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, leaks)
+}
+
+func (h *Handler) GoroutineGroups(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	withTerminated, ok := getBoolParam(w, r, terminatedParam)
+	if !ok {
+		return
+	}
+
+	groups, err := h.app.GoroutineGroups(h.ctx, id, withTerminated)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, groups)
+}
+
+func (h *Handler) SchedLatency(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	latency, err := h.app.SchedLatency(h.ctx, id, window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, latency)
+}
+
+func (h *Handler) GCReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	report, err := h.app.GCReport(h.ctx, id, window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, report)
+}
+
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	metrics, err := h.app.Metrics(h.ctx, id, r.URL.Query()[nameParam], window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, metrics)
+}
+
+func (h *Handler) ProcReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	report, err := h.app.ProcReport(h.ctx, id, window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, report)
+}
+
+func (h *Handler) GoroutineSeries(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	series, err := h.app.GoroutineSeries(h.ctx, id, window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, series)
+}
+
+func (h *Handler) Tasks(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	tasks, err := h.app.Tasks(h.ctx, id, window)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, tasks)
+}
+
+func (h *Handler) Logs(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := getIntParam(w, r, limitParam)
+	if !ok {
+		return
+	}
+
+	logs, err := h.app.Logs(h.ctx, id, r.FormValue(categoryParam), r.FormValue(containsParam), limit)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, logs)
+}
+
+func (h *Handler) TraceState(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := h.app.TraceState(h.ctx, id)
+	if err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, state)
+}
+
+// RawTrace responds with the latest window of the raw trace as a file which can be opened by go tool trace
+func (h *Handler) RawTrace(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	// The trace is buffered in order to respond with an error if it can't be written completely
+	var buf bytes.Buffer
+	if err := h.app.WriteRawTrace(h.ctx, id, &buf); err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"trace-%d.out\"", id))
+	w.Write(buf.Bytes())
+}
+
+// ChromeTrace responds with the latest window of the raw trace as Chrome trace-event JSON which can be opened by
+// Perfetto UI
+func (h *Handler) ChromeTrace(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.app.WriteChromeTrace(h.ctx, id, &buf); err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"trace-%d.json\"", id))
+	w.Write(buf.Bytes())
+}
+
+// Pprof responds with a pprof profile of goroutine time or CPU samples of the type given by the type parameter. CPU
+// samples are taken within the window given by the window parameter. Folded stacks are responded with if the format
+// parameter is "folded"
+func (h *Handler) Pprof(w http.ResponseWriter, r *http.Request) {
+	id, ok := getProcID(w, r)
+	if !ok {
+		return
+	}
+
+	window, ok := getDurationParam(w, r, windowParam)
+	if !ok {
+		return
+	}
+
+	typ := object.ProfileType(r.FormValue(typeParam))
+	var buf bytes.Buffer
+	if r.FormValue(formatParam) == foldedFormat {
+		if err := h.app.WriteFoldedStacks(h.ctx, id, typ, window, &buf); err != nil {
+			writeAppError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	if err := h.app.WriteProfile(h.ctx, id, typ, window, &buf); err != nil {
+		writeAppError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%d.pb.gz\"", typ, id))
+	w.Write(buf.Bytes())
+}
+
+// getProcID checks that the request is a GET one and returns a process id from the request path. If the request is
+// not valid, an error response is written and false is returned
+func getProcID(w http.ResponseWriter, r *http.Request) (int, bool) {
 	if !strings.EqualFold(r.Method, "GET") {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("Only GET method is allowed"))
-		return
+		return 0, false
 	}
 
 	idStr := r.PathValue(procIDParam)
 	if idStr == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("id is required"))
-		return
+		return 0, false
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("invalid id"))
-		return
+		return 0, false
+	}
+
+	return id, true
+}
+
+// getDurationParam returns an optional duration URL parameter, zero is returned if the parameter is absent. If the
+// parameter is not valid, an error response is written and false is returned
+func getDurationParam(w http.ResponseWriter, r *http.Request, name string) (time.Duration, bool) {
+	value := r.FormValue(name)
+	if value == "" {
+		return 0, true
+	}
+
+	ret, err := time.ParseDuration(value)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid " + name))
+		return 0, false
+	}
+
+	return ret, true
+}
+
+// getBoolParam returns an optional boolean URL parameter, false is returned if the parameter is absent. If the
+// parameter is not valid, an error response is written and false is returned as the second value
+func getBoolParam(w http.ResponseWriter, r *http.Request, name string) (bool, bool) {
+	value := r.FormValue(name)
+	if value == "" {
+		return false, true
+	}
+
+	ret, err := strconv.ParseBool(value)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid " + name))
+		return false, false
+	}
+
+	return ret, true
+}
+
+// getIntParam returns an optional integer URL parameter, zero is returned if the parameter is absent. If the
+// parameter is not valid, an error response is written and false is returned
+func getIntParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.FormValue(name)
+	if value == "" {
+		return 0, true
+	}
+
+	ret, err := strconv.Atoi(value)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid " + name))
+		return 0, false
 	}
 
-	top, err := h.app.TopIdlingGoroutines(h.ctx, id)
+	return ret, true
+}
+
+// writeAppError writes an application error with a status depending on the error, e.g. errors caused by invalid
+// request parameters are written as bad requests
+func writeAppError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, apiError.ErrUnknownRanking), errors.Is(err, apiError.ErrInvalidFilter),
+		errors.Is(err, apiError.ErrUnknownStackFormat), errors.Is(err, apiError.ErrUnknownProfileType):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, apiError.ErrNegativeID):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, apiError.ErrItemNotFound), errors.Is(err, apiError.ErrGoroutineNotFound),
+		errors.Is(err, apiError.ErrStackNotFound), errors.Is(err, apiError.ErrNoRawTrace):
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write([]byte(err.Error()))
+}
+
+// writeJSON writes v as a JSON-encoded response, empty lists are written as "[]"
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		w.Write([]byte("json creation error; " + err.Error()))
 		return
 	}
-
-	data := []byte("[]")
-	if len(top) > 0 {
-		data, err = json.Marshal(top)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("json creation error; " + err.Error()))
-			return
-		}
+	if bytes.Equal(data, []byte("null")) {
+		data = []byte("[]")
 	}
 
 	w.WriteHeader(http.StatusOK)
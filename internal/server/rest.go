@@ -28,6 +28,26 @@ func StartRestServer(ctx context.Context, application *app.App) (*http.Server, e
 	router := http.NewServeMux()
 	router.HandleFunc("/trace-events/listen", h.RunTraceEventsListening)
 	router.HandleFunc("/trace-events/{id}/top-idling-goroutines", h.TopIdlingGoroutines)
+	router.HandleFunc("/trace-events/{id}/top-goroutines", h.TopGoroutines)
+	router.HandleFunc("/trace-events/{id}/goroutines", h.Goroutines)
+	router.HandleFunc("/trace-events/{id}/goroutines/{gid}", h.GoroutineTimeline)
+	router.HandleFunc("/trace-events/{id}/stacks/{sid}", h.Stack)
+	router.HandleFunc("/trace-events/{id}/leaks", h.GoroutineLeaks)
+	router.HandleFunc("/trace-events/{id}/goroutine-groups", h.GoroutineGroups)
+	router.HandleFunc("/trace-events/{id}/spawn-tree", h.SpawnTree)
+	router.HandleFunc("/trace-events/{id}/wake-graph", h.WakeGraph)
+	router.HandleFunc("/trace-events/{id}/contention", h.ContentionSites)
+	router.HandleFunc("/trace-events/{id}/sched-latency", h.SchedLatency)
+	router.HandleFunc("/trace-events/{id}/gc", h.GCReport)
+	router.HandleFunc("/trace-events/{id}/metrics", h.Metrics)
+	router.HandleFunc("/trace-events/{id}/procs", h.ProcReport)
+	router.HandleFunc("/trace-events/{id}/goroutine-series", h.GoroutineSeries)
+	router.HandleFunc("/trace-events/{id}/tasks", h.Tasks)
+	router.HandleFunc("/trace-events/{id}/logs", h.Logs)
+	router.HandleFunc("/trace-events/{id}/raw-trace", h.RawTrace)
+	router.HandleFunc("/trace-events/{id}/chrome-trace", h.ChromeTrace)
+	router.HandleFunc("/trace-events/{id}/pprof", h.Pprof)
+	router.HandleFunc("/trace-events/{id}/state", h.TraceState)
 	router.HandleFunc("/heap-profiles/listen", h.RunHeapProfileProcessing)
 	router.HandleFunc("/heap-profiles/{id}/profiles", h.HeapProfiles)
 
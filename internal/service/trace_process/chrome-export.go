@@ -0,0 +1,333 @@
+package trace_process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/trace"
+)
+
+// Tracks of the Chrome trace are grouped into processes
+const (
+	chromeGoroutinesPID = iota + 1
+	chromeProcsPID
+	chromeRuntimePID
+	chromeTasksPID
+)
+
+type (
+	// chromeEvent is an event of the Chrome trace-event format which is opened by Perfetto UI and chrome://tracing.
+	// Time and duration are in microseconds
+	chromeEvent struct {
+		Name     string         `json:"name,omitempty"`
+		Category string         `json:"cat,omitempty"`
+		Phase    string         `json:"ph"`
+		Time     float64        `json:"ts"`
+		Duration float64        `json:"dur,omitempty"`
+		PID      int            `json:"pid"`
+		TID      int64          `json:"tid"`
+		ID       string         `json:"id,omitempty"`
+		Scope    string         `json:"s,omitempty"`
+		Args     map[string]any `json:"args,omitempty"`
+	}
+
+	// chromeConverter turns trace events into Chrome trace events as they come, so a trace of any size is converted
+	// keeping only the state of goroutines and open ranges
+	chromeConverter struct {
+		w         *bufio.Writer
+		err       error
+		events    int
+		started   bool
+		startTime trace.Time
+		lastTime  trace.Time
+		// names contains start functions of goroutines
+		names   map[trace.GoID]string
+		running map[trace.GoID]chromeRun
+		procs   map[trace.ProcID]struct{}
+		// ranges contains ids of open ranges, regions contains open region types of goroutines
+		ranges  map[string]struct{}
+		regions map[trace.GoID][]string
+		tasks   map[trace.TaskID]string
+	}
+
+	chromeRun struct {
+		start trace.Time
+		proc  trace.ProcID
+	}
+)
+
+// ConvertToChromeTrace reads all events from r and writes them to w as Chrome trace-event JSON which can be opened
+// in Perfetto UI. Goroutine run slices are put on goroutine tracks and on tracks of Ps they have been running on. GC
+// and other runtime ranges, user tasks and regions are written as async slices, metrics as counters and user logs as
+// instant events. The JSON is completed even if reading fails, so a partially read stream is still viewable
+func ConvertToChromeTrace(r *trace.Reader, w io.Writer) error {
+	c := &chromeConverter{
+		w:       bufio.NewWriter(w),
+		names:   make(map[trace.GoID]string),
+		running: make(map[trace.GoID]chromeRun),
+		procs:   make(map[trace.ProcID]struct{}),
+		ranges:  make(map[string]struct{}),
+		regions: make(map[trace.GoID][]string),
+		tasks:   make(map[trace.TaskID]string),
+	}
+	c.writeString(`{"displayTimeUnit":"ns","traceEvents":[`)
+	c.writeProcessNames()
+
+	var readErr error
+	for c.err == nil {
+		ev, err := r.ReadEvent()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = fmt.Errorf("failed to read event; %w", err)
+			}
+			break
+		}
+		c.convert(&ev)
+	}
+	c.finish()
+
+	c.writeString("\n]}\n")
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	if c.err != nil {
+		return fmt.Errorf("failed to write Chrome trace; %w", c.err)
+	}
+	return readErr
+}
+
+// WriteChromeTrace writes the kept window of the raw trace to w as Chrome trace-event JSON
+func (tip *TraceProcess) WriteChromeTrace(w io.Writer) error {
+	var raw bytes.Buffer
+	if err := tip.WriteRawTrace(&raw); err != nil {
+		return err
+	}
+	r, err := trace.NewReader(&raw)
+	if err != nil {
+		return fmt.Errorf("failed to create trace reader; %w", err)
+	}
+
+	return ConvertToChromeTrace(r, w)
+}
+
+func (c *chromeConverter) convert(ev *trace.Event) {
+	if !c.started {
+		c.started, c.startTime = true, ev.Time()
+	}
+	c.lastTime = ev.Time()
+
+	switch ev.Kind() {
+	case trace.EventStateTransition:
+		st := ev.StateTransition()
+		if st.Resource.Kind == trace.ResourceGoroutine {
+			c.convertGoroutineTransition(ev, st)
+		}
+	case trace.EventRangeBegin, trace.EventRangeActive, trace.EventRangeEnd:
+		c.convertRange(ev)
+	case trace.EventTaskBegin, trace.EventTaskEnd:
+		c.convertTask(ev)
+	case trace.EventRegionBegin, trace.EventRegionEnd:
+		c.convertRegion(ev)
+	case trace.EventLog:
+		l := ev.Log()
+		c.write(chromeEvent{
+			Name: "log", Category: l.Category, Phase: "i", Time: c.ts(ev.Time()), PID: chromeGoroutinesPID,
+			TID: int64(ev.Goroutine()), Scope: "t", Args: map[string]any{"message": l.Message, "task": l.Task},
+		})
+	case trace.EventMetric:
+		m := ev.Metric()
+		if m.Value.Kind() != trace.ValueUint64 {
+			return
+		}
+		c.write(chromeEvent{
+			Name: m.Name, Phase: "C", Time: c.ts(ev.Time()), PID: chromeRuntimePID,
+			Args: map[string]any{"value": m.Value.Uint64()},
+		})
+	}
+}
+
+func (c *chromeConverter) convertGoroutineTransition(ev *trace.Event, st trace.StateTransition) {
+	gID := st.Resource.Goroutine()
+	from, to := st.Goroutine()
+	if _, ok := c.names[gID]; !ok {
+		name := fmt.Sprintf("G%d", gID)
+		if from == trace.GoNotExist {
+			name = stackFunction(st.Stack, name)
+		}
+		c.names[gID] = name
+		c.writeThreadName(chromeGoroutinesPID, int64(gID), fmt.Sprintf("G%d %s", gID, name))
+	}
+
+	if run, ok := c.running[gID]; ok && to != trace.GoRunning {
+		delete(c.running, gID)
+		c.writeRun(gID, run, ev.Time(), map[string]any{"to": to.String(), "reason": waitReason(st, to)})
+	}
+	if _, ok := c.running[gID]; !ok && to == trace.GoRunning {
+		c.running[gID] = chromeRun{start: ev.Time(), proc: ev.Proc()}
+	}
+	if to == trace.GoNotExist {
+		delete(c.names, gID)
+		delete(c.regions, gID)
+	}
+}
+
+// writeRun writes a run slice to the goroutine's track and to the track of the P it has been running on
+func (c *chromeConverter) writeRun(gID trace.GoID, run chromeRun, end trace.Time, args map[string]any) {
+	name := c.names[gID]
+	ts, dur := c.ts(run.start), float64(end-run.start)/1e3
+	c.write(chromeEvent{Name: name, Phase: "X", Time: ts, Duration: dur, PID: chromeGoroutinesPID, TID: int64(gID),
+		Args: args})
+	if run.proc == trace.NoProc {
+		return
+	}
+
+	if _, ok := c.procs[run.proc]; !ok {
+		c.procs[run.proc] = struct{}{}
+		c.writeThreadName(chromeProcsPID, int64(run.proc), fmt.Sprintf("P%d", run.proc))
+	}
+	c.write(chromeEvent{Name: fmt.Sprintf("G%d %s", gID, name), Phase: "X", Time: ts, Duration: dur,
+		PID: chromeProcsPID, TID: int64(run.proc)})
+}
+
+// convertRange writes runtime ranges like GC phases, stop-the-world pauses, sweeping and mark assists as async slices
+// of the process their scope belongs to
+func (c *chromeConverter) convertRange(ev *trace.Event) {
+	r := ev.Range()
+	scope := r.Scope
+	if scope.Kind == trace.ResourceGoroutine && ev.Kind() != trace.EventRangeActive {
+		scope = trace.MakeResourceID(ev.Goroutine())
+	}
+
+	pid, id := chromeRuntimePID, r.Name
+	switch scope.Kind {
+	case trace.ResourceGoroutine:
+		pid, id = chromeGoroutinesPID, fmt.Sprintf("G%d %s", scope.Goroutine(), r.Name)
+	case trace.ResourceProc:
+		pid, id = chromeProcsPID, fmt.Sprintf("P%d %s", scope.Proc(), r.Name)
+	}
+
+	_, open := c.ranges[id]
+	switch {
+	case ev.Kind() != trace.EventRangeEnd && !open:
+		c.ranges[id] = struct{}{}
+		c.write(chromeEvent{Name: r.Name, Category: "runtime", Phase: "b", Time: c.ts(ev.Time()), PID: pid, ID: id})
+	case ev.Kind() == trace.EventRangeEnd && open:
+		delete(c.ranges, id)
+		c.write(chromeEvent{Name: r.Name, Category: "runtime", Phase: "e", Time: c.ts(ev.Time()), PID: pid, ID: id})
+	}
+}
+
+func (c *chromeConverter) convertTask(ev *trace.Event) {
+	task := ev.Task()
+	id := fmt.Sprintf("task %d", task.ID)
+	if ev.Kind() == trace.EventTaskBegin {
+		c.tasks[task.ID] = task.Type
+		c.write(chromeEvent{
+			Name: task.Type, Category: "task", Phase: "b", Time: c.ts(ev.Time()), PID: chromeTasksPID, ID: id,
+			Args: map[string]any{"parent": task.Parent, "goroutine": ev.Goroutine()},
+		})
+		return
+	}
+
+	typ, ok := c.tasks[task.ID]
+	if !ok {
+		return
+	}
+	delete(c.tasks, task.ID)
+	c.write(chromeEvent{Name: typ, Category: "task", Phase: "e", Time: c.ts(ev.Time()), PID: chromeTasksPID, ID: id})
+}
+
+// convertRegion writes regions as async slices of the goroutine, they are strictly nested within a goroutine, so all
+// of them share a single track
+func (c *chromeConverter) convertRegion(ev *trace.Event) {
+	region := ev.Region()
+	gID := ev.Goroutine()
+	id := fmt.Sprintf("G%d regions", gID)
+	if ev.Kind() == trace.EventRegionBegin {
+		c.regions[gID] = append(c.regions[gID], region.Type)
+		c.write(chromeEvent{
+			Name: region.Type, Category: "region", Phase: "b", Time: c.ts(ev.Time()), PID: chromeGoroutinesPID, ID: id,
+			Args: map[string]any{"task": region.Task},
+		})
+		return
+	}
+
+	// The beginning of the region might not be in the trace
+	open := c.regions[gID]
+	idx := len(open) - 1
+	for idx >= 0 && open[idx] != region.Type {
+		idx--
+	}
+	if idx == -1 {
+		return
+	}
+	for i := len(open) - 1; i >= idx; i-- {
+		c.write(chromeEvent{
+			Name: open[i], Category: "region", Phase: "e", Time: c.ts(ev.Time()), PID: chromeGoroutinesPID, ID: id,
+		})
+	}
+	c.regions[gID] = open[:idx]
+}
+
+// finish closes run slices of goroutines still running at the last event
+func (c *chromeConverter) finish() {
+	for gID, run := range c.running {
+		c.writeRun(gID, run, c.lastTime, nil)
+	}
+}
+
+func (c *chromeConverter) writeProcessNames() {
+	for i, name := range []string{"Goroutines", "Procs", "Runtime", "User tasks"} {
+		pid := chromeGoroutinesPID + i
+		c.write(chromeEvent{Name: "process_name", Phase: "M", PID: pid, Args: map[string]any{"name": name}})
+		c.write(chromeEvent{Name: "process_sort_index", Phase: "M", PID: pid, Args: map[string]any{"sort_index": pid}})
+	}
+}
+
+func (c *chromeConverter) writeThreadName(pid int, tid int64, name string) {
+	c.write(chromeEvent{Name: "thread_name", Phase: "M", PID: pid, TID: tid, Args: map[string]any{"name": name}})
+	c.write(chromeEvent{Name: "thread_sort_index", Phase: "M", PID: pid, TID: tid,
+		Args: map[string]any{"sort_index": tid}})
+}
+
+func (c *chromeConverter) write(ev chromeEvent) {
+	if c.err != nil {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	if c.events > 0 {
+		c.writeString(",")
+	}
+	c.events++
+	c.writeString("\n")
+	_, c.err = c.w.Write(data)
+}
+
+func (c *chromeConverter) writeString(s string) {
+	if c.err == nil {
+		_, c.err = c.w.WriteString(s)
+	}
+}
+
+// ts converts the trace time to microseconds since the first event
+func (c *chromeConverter) ts(t trace.Time) float64 {
+	return float64(t-c.startTime) / 1e3
+}
+
+// stackFunction returns the top function of the stack or def if the stack is empty
+func stackFunction(stack trace.Stack, def string) string {
+	for frame := range stack.Frames() {
+		return frame.Func
+	}
+
+	return def
+}
@@ -0,0 +1,77 @@
+package trace_process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	expTrace "golang.org/x/exp/trace"
+)
+
+func TestConvertToChromeTrace(t *testing.T) {
+	data := collectTrace(t, func() {
+		ctx, task := trace.NewTask(context.Background(), "request")
+		trace.WithRegion(ctx, "handle", func() {
+			trace.Log(ctx, "handler", "started")
+			done := make(chan struct{})
+			go profiledWorker(done)
+			<-done
+		})
+		task.End()
+		runtime.GC()
+	})
+	r, err := expTrace.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, ConvertToChromeTrace(r, &buf))
+	var out struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out), buf.String())
+	events := out.TraceEvents
+
+	find := func(phase string, pid int, name string) *chromeEvent {
+		idx := slices.IndexFunc(events, func(ev chromeEvent) bool {
+			return ev.Phase == phase && ev.PID == pid && strings.Contains(ev.Name, name)
+		})
+		if idx == -1 {
+			return nil
+		}
+		return &events[idx]
+	}
+
+	// The worker might be preempted, so its running time is split among several slices
+	run := find("X", chromeGoroutinesPID, "profiledWorker")
+	require.NotNil(t, run)
+	var running float64
+	for _, ev := range events {
+		if ev.Phase == "X" && ev.PID == chromeGoroutinesPID && ev.TID == run.TID {
+			running += ev.Duration
+		}
+	}
+	assert.GreaterOrEqual(t, running, float64(5*time.Millisecond/time.Microsecond))
+	procRun := find("X", chromeProcsPID, "profiledWorker")
+	require.NotNil(t, procRun)
+	assert.Equal(t, run.Time, procRun.Time)
+	require.NotNil(t, find("M", chromeGoroutinesPID, "thread_name"))
+
+	for _, phase := range []string{"b", "e"} {
+		assert.NotNil(t, find(phase, chromeTasksPID, "request"), phase)
+		assert.NotNil(t, find(phase, chromeGoroutinesPID, "handle"), phase)
+		assert.NotNil(t, find(phase, chromeRuntimePID, rangeGCMark), phase)
+	}
+	log := find("i", chromeGoroutinesPID, "log")
+	require.NotNil(t, log)
+	assert.Equal(t, "handler", log.Category)
+	assert.Equal(t, "started", log.Args["message"])
+	assert.NotNil(t, find("C", chromeRuntimePID, "/gc/heap/goal:bytes"))
+}
@@ -0,0 +1,111 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// Wait reasons of contention, other reasons like "sleep" or "network" don't mean goroutines compete for something
+const (
+	waitReasonChanSend    = "chan send"
+	waitReasonChanReceive = "chan receive"
+	waitReasonSelect      = "select"
+)
+
+// defaultNumberOfContentionSites is a number of contention sites returned if no limit is given
+const defaultNumberOfContentionSites = 20
+
+type (
+	contentionKey struct {
+		reason string
+		stack  stackID
+	}
+
+	// contentionSite accumulates finished waits of goroutines blocked at the same stack for the same reason
+	contentionSite struct {
+		key       contentionKey
+		totalWait time.Duration
+		waiters   int64
+		maxWait   time.Duration
+	}
+)
+
+// ContentionSites returns limit sites with the longest total time goroutines have been blocked there on sync.Mutex,
+// sync.RWMutex, channel operations and select statements. All sites are returned if limit is negative
+func (tip *TraceProcess) ContentionSites(limit int) []object.ContentionSite {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	sites := make(map[*contentionSite]*object.ContentionSite, len(tip.contention))
+	for _, site := range tip.contention {
+		sites[site] = &object.ContentionSite{
+			Reason:    site.key.reason,
+			Stack:     tip.stacks.rendered(site.key.stack),
+			TotalWait: site.totalWait,
+			Waiters:   site.waiters,
+			MaxWait:   site.maxWait,
+		}
+	}
+	// Waits in progress are accounted up to the last event, otherwise goroutines blocked forever would be missed
+	for _, stat := range tip.livingStats {
+		if stat.blockedAt == nil || stat.state != trace.GoWaiting {
+			continue
+		}
+		site := sites[stat.blockedAt]
+		wait := tip.lastEventTime.Sub(stat.lastTransition)
+		site.TotalWait += wait
+		site.MaxWait = max(site.MaxWait, wait)
+		site.Blocked++
+	}
+
+	ret := make([]object.ContentionSite, 0, len(sites))
+	for _, site := range sites {
+		ret = append(ret, *site)
+	}
+	slices.SortFunc(ret, func(a, b object.ContentionSite) int {
+		return cmp.Or(cmp.Compare(b.TotalWait, a.TotalWait), cmp.Compare(b.Waiters, a.Waiters))
+	})
+	if limit == 0 {
+		limit = defaultNumberOfContentionSites
+	}
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+
+	return ret
+}
+
+// blockAt remembers the site where the goroutine has blocked if the reason is a contention one
+func (tip *TraceProcess) blockAt(stat *goroutineStat, stack stackID) {
+	switch stat.waitReason {
+	case waitReasonMutex, waitReasonRWMutex, waitReasonChanSend, waitReasonChanReceive, waitReasonSelect:
+	default:
+		return
+	}
+
+	key := contentionKey{reason: stat.waitReason, stack: stack}
+	site, ok := tip.contention[key]
+	if !ok {
+		site = &contentionSite{key: key}
+		tip.contention[key] = site
+	}
+	stat.blockedAt = site
+}
+
+// unblock adds the wait which has lasted since the last transition to the site the goroutine has been blocked at
+func (gs *goroutineStat) unblock(now trace.Time) {
+	if gs.blockedAt == nil {
+		return
+	}
+
+	wait := now.Sub(gs.lastTransition)
+	gs.blockedAt.totalWait += wait
+	gs.blockedAt.waiters++
+	gs.blockedAt.maxWait = max(gs.blockedAt.maxWait, wait)
+	gs.blockedAt = nil
+}
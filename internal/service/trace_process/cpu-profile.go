@@ -0,0 +1,123 @@
+package trace_process
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+const (
+	// defaultCPUSlotDuration and defaultCPUSlots define how long CPU samples are kept: every slot aggregates samples of
+	// defaultCPUSlotDuration, the oldest slot is dropped when the number of slots exceeds defaultCPUSlots
+	defaultCPUSlotDuration = time.Minute
+	defaultCPUSlots        = 60
+	// defaultCPUSamplePeriod is the interval between CPU samples at the default rate of runtime/pprof.StartCPUProfile.
+	// The trace doesn't contain the rate, so it is assumed unless another period is set by WithCPUSamplePeriod
+	defaultCPUSamplePeriod = 10 * time.Millisecond
+)
+
+type (
+	// cpuProfile keeps CPU samples of the trace aggregated by time slots, so that a profile within a time window can be
+	// got. Samples come with the trace only while CPU profiling is enabled in the target
+	cpuProfile struct {
+		slots []cpuSlot
+	}
+
+	cpuSlot struct {
+		start   trace.Time
+		samples map[cpuSampleKey]int64
+	}
+
+	// cpuSampleKey identifies samples of the same stack taken from goroutines of the same group. The goroutine is
+	// NoGoroutine unless samples are attributed to goroutines
+	cpuSampleKey struct {
+		stack stackID
+		gID   trace.GoID
+		// group is nil for samples taken while no goroutine has been running
+		group *stackGroup
+	}
+
+	cpuProfileConfig struct {
+		slotDuration time.Duration
+		slots        int
+		period       time.Duration
+		// goroutines is true if samples are attributed to goroutines, not only to their groups
+		goroutines bool
+	}
+)
+
+// WithCPUSampleSlots sets how CPU samples are kept: every slot aggregates samples of slotDuration, the number of slots
+// is limited by slots
+func WithCPUSampleSlots(slotDuration time.Duration, slots int) Option {
+	return func(tp *TraceProcess) {
+		if slotDuration > 0 && slots > 0 {
+			tp.cfg.cpuSamples.slotDuration = slotDuration
+			tp.cfg.cpuSamples.slots = slots
+		}
+	}
+}
+
+// WithCPUSamplePeriod sets the interval between CPU samples, it has to be set if the target changes the rate of CPU
+// profiling by runtime.SetCPUProfileRate
+func WithCPUSamplePeriod(period time.Duration) Option {
+	return func(tp *TraceProcess) {
+		if period > 0 {
+			tp.cfg.cpuSamples.period = period
+		}
+	}
+}
+
+// WithCPUSampleGoroutines makes CPU samples attributed to goroutines, not only to their groups. The number of kept
+// samples grows with the number of goroutines running the same code
+func WithCPUSampleGoroutines(enabled bool) Option {
+	return func(tp *TraceProcess) {
+		tp.cfg.cpuSamples.goroutines = enabled
+	}
+}
+
+func (tip *TraceProcess) processStackSample(ev *trace.Event) {
+	key := cpuSampleKey{stack: tip.stacks.intern(ev.Stack()), gID: trace.NoGoroutine}
+	if stat, ok := tip.livingStats[ev.Goroutine()]; ok {
+		key.group = stat.group
+	}
+	if tip.cfg.cpuSamples.goroutines {
+		key.gID = ev.Goroutine()
+	}
+	tip.cpu.add(tip.cfg.cpuSamples, tip.eventTime(ev), key)
+}
+
+func (cp *cpuProfile) add(cfg cpuProfileConfig, at trace.Time, key cpuSampleKey) {
+	start := at - at%trace.Time(cfg.slotDuration)
+	last := len(cp.slots) - 1
+	if last == -1 || cp.slots[last].start < start {
+		cp.slots = append(cp.slots, cpuSlot{start: start, samples: make(map[cpuSampleKey]int64)})
+		last++
+	}
+	// Events may slightly go back in time between generations, such samples are put into the last slot
+	cp.slots[last].samples[key]++
+
+	oldest := start - trace.Time(cfg.slotDuration)*trace.Time(cfg.slots-1)
+	drop := 0
+	for drop < len(cp.slots) && cp.slots[drop].start < oldest {
+		drop++
+	}
+	if drop > 0 {
+		cp.slots = append(cp.slots[:0], cp.slots[drop:]...)
+	}
+}
+
+// samples calls f for samples of slots intersecting with the window ending at "now". If window is not positive, all
+// slots are used
+func (cp *cpuProfile) samples(
+	cfg cpuProfileConfig, now trace.Time, window time.Duration, f func(key cpuSampleKey, count int64),
+) {
+	from := now - trace.Time(window)
+	for i := range cp.slots {
+		if window > 0 && cp.slots[i].start+trace.Time(cfg.slotDuration) <= from {
+			continue
+		}
+		for key, count := range cp.slots[i].samples {
+			f(key, count)
+		}
+	}
+}
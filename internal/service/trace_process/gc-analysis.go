@@ -0,0 +1,314 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultGCCycles is a maximum number of GC cycles kept
+	defaultGCCycles = 1000
+	// defaultGCSlotDuration and defaultGCSlots define resolution and depth of GC CPU fraction series and of GC work
+	// reported within a window
+	defaultGCSlotDuration = time.Second
+	defaultGCSlots        = 3600
+	// defaultNumberOfMarkAssists is a number of goroutines returned as top mark assist ones
+	defaultNumberOfMarkAssists = 10
+
+	rangeSTWPrefix       = "stop-the-world ("
+	rangeGCMark          = "GC concurrent mark phase"
+	rangeGCMarkAssist    = "GC mark assist"
+	rangeGCSweep         = "GC incremental sweep"
+	attrBytesSwept       = "bytes swept"
+	attrBytesReclaimed   = "bytes reclaimed"
+	gcBgMarkWorkerFunc   = "runtime.gcBgMarkWorker"
+	gcPauseReasonPrefix  = "GC "
+	metricGOMAXPROCSName = "/sched/gomaxprocs:threads"
+)
+
+type (
+	// gcStat contains GC activity reconstructed from range events
+	gcStat struct {
+		// activeRanges contains start times of ranges which have begun but not ended yet
+		activeRanges   map[activeRangeKey]trace.Time
+		cycles         []gcCycle
+		cyclesCount    int
+		pauses         windowedHistogram
+		pausesByReason map[string]*windowedHistogram
+		slots          []gcSlot
+	}
+
+	activeRangeKey struct {
+		name  string
+		scope trace.ResourceID
+	}
+
+	gcCycle struct {
+		number       int
+		start        trace.Time
+		markDuration time.Duration
+		pauses       []object.GCPause
+	}
+
+	// gcSlot contains GC work done within defaultGCSlotDuration. Durations are spread over the slots they overlap,
+	// swept and reclaimed bytes belong to the slot where sweeping has ended
+	gcSlot struct {
+		start          trace.Time
+		gcCPU          time.Duration
+		gomaxprocs     int
+		markAssist     time.Duration
+		sweep          time.Duration
+		bytesSwept     uint64
+		bytesReclaimed uint64
+	}
+)
+
+func newGCStat() gcStat {
+	return gcStat{
+		activeRanges:   make(map[activeRangeKey]trace.Time),
+		pausesByReason: make(map[string]*windowedHistogram),
+	}
+}
+
+// GCReport returns GC cycles, pauses, mark assist and sweep work and CPU usage within the window ending at the last
+// event. If window is not positive, all collected data is used. Top mark assist goroutines are ranked by their whole
+// lifetime regardless of the window
+func (tip *TraceProcess) GCReport(window time.Duration) object.GCReport {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	gc := &tip.gc
+	from := tip.lastEventTime - trace.Time(window)
+	inWindow := func(t trace.Time) bool {
+		return window <= 0 || t >= from
+	}
+
+	pauses := gc.pauses.histogram(tip.cfg.histograms, tip.lastEventTime, window)
+	ret := object.GCReport{
+		Window:         window,
+		Pauses:         pauses.convert(),
+		PausesByReason: make(map[string]object.LatencyHistogram, len(gc.pausesByReason)),
+	}
+	for reason, wh := range gc.pausesByReason {
+		if hist := wh.histogram(tip.cfg.histograms, tip.lastEventTime, window); hist.count > 0 {
+			ret.PausesByReason[reason] = hist.convert()
+		}
+	}
+	for _, cycle := range gc.cycles {
+		if inWindow(cycle.start) {
+			ret.Cycles = append(ret.Cycles, object.GCCycle{
+				Number:       cycle.number,
+				Start:        cycle.start,
+				MarkDuration: cycle.markDuration,
+				Pauses:       cycle.pauses,
+			})
+		}
+	}
+	for _, slot := range gc.slots {
+		if window > 0 && slot.start+trace.Time(defaultGCSlotDuration) <= from {
+			continue
+		}
+		ret.MarkAssistDuration += slot.markAssist
+		ret.SweepDuration += slot.sweep
+		ret.BytesSwept += slot.bytesSwept
+		ret.BytesReclaimed += slot.bytesReclaimed
+		if !inWindow(slot.start) {
+			continue
+		}
+		ret.CPUFraction = append(ret.CPUFraction, object.GCCPUFraction{
+			Time:       slot.start,
+			Interval:   defaultGCSlotDuration,
+			GOMAXPROCS: slot.gomaxprocs,
+			Fraction:   float64(slot.gcCPU) / float64(defaultGCSlotDuration*time.Duration(slot.gomaxprocs)),
+		})
+	}
+	ret.TopLifetimeMarkAssists = tip.topMarkAssists()
+
+	return ret
+}
+
+func (tip *TraceProcess) topMarkAssists() []object.GoroutineMarkAssist {
+	var ret []object.GoroutineMarkAssist
+	add := func(stat *goroutineStat) {
+		if stat.markAssistDuration == 0 {
+			return
+		}
+		ret = append(ret, object.GoroutineMarkAssist{
+			ID:              stat.gID,
+			Stack:           tip.stacks.rendered(stat.stack),
+			TransitionStack: tip.stacks.rendered(stat.transitionStack),
+			Duration:        stat.markAssistDuration,
+		})
+	}
+	for _, stat := range tip.livingStats {
+		add(stat)
+	}
+	for _, stat := range tip.terminatedStats {
+		add(stat)
+	}
+
+	slices.SortFunc(ret, func(a, b object.GoroutineMarkAssist) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	if len(ret) > defaultNumberOfMarkAssists {
+		ret = ret[:defaultNumberOfMarkAssists]
+	}
+
+	return ret
+}
+
+func (tip *TraceProcess) processRangeEvent(ev *trace.Event) {
+	gc := &tip.gc
+	r := ev.Range()
+	key := activeRangeKey{name: r.Name, scope: r.Scope}
+	if r.Scope.Kind == trace.ResourceGoroutine && ev.Kind() != trace.EventRangeActive {
+		key.scope = trace.MakeResourceID(ev.Goroutine())
+	}
+
+	now := tip.eventTime(ev)
+	if ev.Kind() != trace.EventRangeEnd {
+		gc.activeRanges[key] = now
+		if r.Name == rangeGCMark {
+			gc.startCycle(now)
+		}
+		return
+	}
+
+	start, ok := gc.activeRanges[key]
+	if !ok {
+		return
+	}
+	delete(gc.activeRanges, key)
+	elapsed := now.Sub(start)
+
+	switch {
+	case strings.HasPrefix(r.Name, rangeSTWPrefix):
+		reason := strings.TrimSuffix(strings.TrimPrefix(r.Name, rangeSTWPrefix), ")")
+		tip.addGCPause(start, now, reason, elapsed)
+	case r.Name == rangeGCMark:
+		if last := len(gc.cycles) - 1; last >= 0 {
+			gc.cycles[last].markDuration = elapsed
+		}
+	case r.Name == rangeGCMarkAssist:
+		tip.spreadGCWork(start, now, func(slot *gcSlot, d time.Duration) {
+			slot.markAssist += d
+			slot.gcCPU += d
+		})
+		if stat := tip.findStat(key.scope.Goroutine()); stat != nil {
+			stat.markAssistDuration += elapsed
+		}
+	case r.Name == rangeGCSweep:
+		tip.spreadGCWork(start, now, func(slot *gcSlot, d time.Duration) {
+			slot.sweep += d
+		})
+		slot := tip.gcSlot(now)
+		if slot == nil {
+			return
+		}
+		for _, attr := range ev.RangeAttributes() {
+			switch attr.Name {
+			case attrBytesSwept:
+				slot.bytesSwept += attr.Value.Uint64()
+			case attrBytesReclaimed:
+				slot.bytesReclaimed += attr.Value.Uint64()
+			}
+		}
+	}
+}
+
+func (tip *TraceProcess) addGCPause(start, now trace.Time, reason string, pause time.Duration) {
+	gc := &tip.gc
+	gc.pauses.add(tip.cfg.histograms, now, pause)
+	wh, ok := gc.pausesByReason[reason]
+	if !ok {
+		wh = &windowedHistogram{}
+		gc.pausesByReason[reason] = wh
+	}
+	wh.add(tip.cfg.histograms, now, pause)
+	// All Ps are stopped during a pause
+	tip.addGCCPU(start, now, tip.gomaxprocs)
+
+	// Sweep termination and mark termination pauses happen around the mark phase of the latest cycle
+	if last := len(gc.cycles) - 1; last >= 0 && strings.HasPrefix(reason, gcPauseReasonPrefix) {
+		gc.cycles[last].pauses = append(gc.cycles[last].pauses, object.GCPause{
+			Start:    start,
+			Reason:   reason,
+			Duration: pause,
+		})
+	}
+}
+
+func (gc *gcStat) startCycle(now trace.Time) {
+	gc.cyclesCount++
+	if len(gc.cycles) == defaultGCCycles {
+		gc.cycles = append(gc.cycles[:0], gc.cycles[1:]...)
+	}
+	gc.cycles = append(gc.cycles, gcCycle{number: gc.cyclesCount, start: now})
+}
+
+// addGCCPU adds CPU time used by GC on procs Ps from start to end to the slots the interval overlaps
+func (tip *TraceProcess) addGCCPU(start, end trace.Time, procs int) {
+	tip.spreadGCWork(start, end, func(slot *gcSlot, d time.Duration) {
+		slot.gcCPU += d * time.Duration(procs)
+	})
+}
+
+// spreadGCWork distributes the interval from start to end over GC slots, add is called with every slot the interval
+// overlaps and the duration of the overlap
+func (tip *TraceProcess) spreadGCWork(start, end trace.Time, add func(slot *gcSlot, d time.Duration)) {
+	slotDuration := trace.Time(defaultGCSlotDuration)
+	for slotStart := start - start%slotDuration; slotStart < end; slotStart += slotDuration {
+		slot := tip.gcSlot(slotStart)
+		if slot == nil || slot.start != slotStart {
+			continue
+		}
+		add(slot, min(end, slotStart+slotDuration).Sub(max(start, slotStart)))
+	}
+}
+
+// gcSlot returns a slot containing "at", a new slot is created if "at" is after the last one. Nil is returned if the
+// slot has been dropped already
+func (tip *TraceProcess) gcSlot(at trace.Time) *gcSlot {
+	gc := &tip.gc
+	start := at - at%trace.Time(defaultGCSlotDuration)
+	last := len(gc.slots) - 1
+	if last >= 0 && gc.slots[last].start >= start {
+		idx, found := slices.BinarySearchFunc(gc.slots, start, func(slot gcSlot, t trace.Time) int {
+			return cmp.Compare(slot.start, t)
+		})
+		if !found {
+			return nil
+		}
+		return &gc.slots[idx]
+	}
+
+	if len(gc.slots) == defaultGCSlots {
+		gc.slots = append(gc.slots[:0], gc.slots[1:]...)
+	}
+	gc.slots = append(gc.slots, gcSlot{start: start, gomaxprocs: tip.gomaxprocs})
+	return &gc.slots[len(gc.slots)-1]
+}
+
+// findStat returns a living or terminated goroutine by id, nil is returned if there is no such goroutine
+func (tip *TraceProcess) findStat(gID trace.GoID) *goroutineStat {
+	if stat, ok := tip.livingStats[gID]; ok {
+		return stat
+	}
+	return tip.terminatedStats[gID]
+}
+
+// isGCWorker checks if the stack belongs to a GC background mark worker
+func isGCWorker(stack trace.Stack) bool {
+	for frame := range stack.Frames() {
+		if frame.Func == gcBgMarkWorkerFunc {
+			return true
+		}
+	}
+	return false
+}
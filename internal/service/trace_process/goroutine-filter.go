@@ -0,0 +1,432 @@
+package trace_process
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// A filter expression consists of comparisons "field op value" combined with "and", "or", "not" and parentheses, e.g.
+//
+//	idle > 30s and stack ~ "database/sql" and creator ~ pkg/worker.Start
+//
+// Text fields support "=" and "!=" (case-insensitive) and "~" and "!~" (regular expressions), numeric fields support
+// "=", "!=", ">", ">=", "<" and "<=". Values containing spaces, parentheses or operator characters must be quoted.
+//
+// Text fields:
+//   - stack: the stack the goroutine has started with
+//   - creator: the stack of the go statement which created the goroutine
+//   - blocking: the stack where the goroutine has blocked at the last time
+//   - func, file: function names and file paths of frames of both stacks, any frame may match
+//   - state: Running, Runnable, Waiting, Syscall or NotExist for terminated goroutines
+//   - reason: the reason of the current Waiting or Syscall state
+//
+// Numeric fields:
+//   - id, blocks: integers
+//   - idle, exec, lifetime, runnable, latency: durations like 1m30s
+
+type (
+	// goroutineFilter returns true if the goroutine matches the filter, now is the time of the last event
+	goroutineFilter func(gs *goroutineStat, now trace.Time) bool
+
+	filterField struct {
+		// text or number is set depending on the field type, parse converts a value of a numeric field
+		text   func(gs *goroutineStat, stacks *stackTable) iter.Seq[string]
+		number func(gs *goroutineStat, now trace.Time) int64
+		parse  func(value string) (int64, error)
+	}
+
+	filterParser struct {
+		tokens []filterToken
+		pos    int
+		stacks *stackTable
+	}
+
+	filterToken struct {
+		text string
+		// quoted is true for string literals, they are never treated as keywords or operators
+		quoted bool
+		offset int
+	}
+)
+
+var (
+	filterFields = map[string]filterField{
+		"stack": {text: func(gs *goroutineStat, stacks *stackTable) iter.Seq[string] {
+			return single(stacks.rendered(gs.transitionStack))
+		}},
+		"creator": {text: func(gs *goroutineStat, stacks *stackTable) iter.Seq[string] {
+			return single(stacks.rendered(gs.stack))
+		}},
+		"blocking": {text: func(gs *goroutineStat, stacks *stackTable) iter.Seq[string] {
+			return single(stacks.rendered(gs.blockingStack()))
+		}},
+		"func": {text: func(gs *goroutineStat, stacks *stackTable) iter.Seq[string] {
+			return frameParts(gs, stacks, func(f object.StackFrame) string { return f.Function })
+		}},
+		"file": {text: func(gs *goroutineStat, stacks *stackTable) iter.Seq[string] {
+			return frameParts(gs, stacks, func(f object.StackFrame) string { return fmt.Sprintf("%s:%d", f.File, f.Line) })
+		}},
+		"state":  {text: func(gs *goroutineStat, _ *stackTable) iter.Seq[string] { return single(gs.state.String()) }},
+		"reason": {text: func(gs *goroutineStat, _ *stackTable) iter.Seq[string] { return single(gs.waitReason) }},
+		"id": {
+			number: func(gs *goroutineStat, _ trace.Time) int64 { return int64(gs.gID) },
+			parse:  parseFilterInt,
+		},
+		"blocks": {
+			number: func(gs *goroutineStat, _ trace.Time) int64 { return int64(gs.blockCount) },
+			parse:  parseFilterInt,
+		},
+		"idle": {
+			number: func(gs *goroutineStat, now trace.Time) int64 { return int64(gs.idleAt(now)) },
+			parse:  parseFilterDuration,
+		},
+		"exec": {
+			number: func(gs *goroutineStat, _ trace.Time) int64 { return int64(gs.execDuration) },
+			parse:  parseFilterDuration,
+		},
+		"lifetime": {
+			number: func(gs *goroutineStat, now trace.Time) int64 { return int64(gs.lifetimeAt(now)) },
+			parse:  parseFilterDuration,
+		},
+		"runnable": {
+			number: func(gs *goroutineStat, now trace.Time) int64 {
+				_, runnable := gs.waitDurationsAt(now)
+				return int64(runnable)
+			},
+			parse: parseFilterDuration,
+		},
+		"latency": {
+			number: func(gs *goroutineStat, _ trace.Time) int64 { return int64(gs.schedLatency) },
+			parse:  parseFilterDuration,
+		},
+	}
+
+	filterOperators = []string{"!=", ">=", "<=", "!~", "=", ">", "<", "~"}
+)
+
+// Goroutines returns living and terminated goroutines matching the filter ordered by ids. An empty filter matches all
+// goroutines. If limit is positive, not more than limit goroutines are returned
+func (tip *TraceProcess) Goroutines(filter string, limit int) ([]object.TopGoroutine, error) {
+	match, err := compileGoroutineFilter(filter, &tip.stacks)
+	if err != nil {
+		return nil, err
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	var stats []*goroutineStat
+	for _, m := range []map[trace.GoID]*goroutineStat{tip.livingStats, tip.terminatedStats} {
+		for _, stat := range m {
+			if match(stat, tip.lastEventTime) {
+				stats = append(stats, stat)
+			}
+		}
+	}
+	slices.SortFunc(stats, func(a, b *goroutineStat) int {
+		return cmp.Compare(a.gID, b.gID)
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	ret := make([]object.TopGoroutine, 0, len(stats))
+	for _, stat := range stats {
+		ret = append(ret, tip.convertStatToTop(stat))
+	}
+
+	return ret, nil
+}
+
+// compileGoroutineFilter parses the filter expression, an empty expression matches all goroutines. Stacks are looked up
+// in the stack table, so the filter has to be used under the trace process lock
+func compileGoroutineFilter(expr string, stacks *stackTable) (goroutineFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apiError.ErrInvalidFilter, err)
+	}
+	if len(tokens) == 0 {
+		return func(*goroutineStat, trace.Time) bool { return true }, nil
+	}
+
+	p := filterParser{tokens: tokens, stacks: stacks}
+	ret, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apiError.ErrInvalidFilter, err)
+	}
+
+	return ret, nil
+}
+
+func (p *filterParser) parseOr() (goroutineFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(gs *goroutineStat, now trace.Time) bool { return l(gs, now) || right(gs, now) }
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (goroutineFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(gs *goroutineStat, now trace.Time) bool { return l(gs, now) && right(gs, now) }
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (goroutineFilter, error) {
+	if p.keyword("not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(gs *goroutineStat, now trace.Time) bool { return !operand(gs, now) }, nil
+	}
+
+	if p.keyword("(") {
+		ret, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		return ret, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (goroutineFilter, error) {
+	name, ok := p.next()
+	if !ok {
+		return nil, p.errorf("field expected")
+	}
+	field, ok := filterFields[strings.ToLower(name.text)]
+	if !ok || name.quoted {
+		return nil, p.errorf("unknown field %q", name.text)
+	}
+	op, ok := p.next()
+	if !ok || op.quoted || !slices.Contains(filterOperators, op.text) {
+		return nil, p.errorf("operator expected after %q", name.text)
+	}
+	value, ok := p.next()
+	if !ok {
+		return nil, p.errorf("value expected after %q", op.text)
+	}
+
+	if field.text != nil {
+		return textComparison(field, op.text, value.text, p.stacks)
+	}
+	return numberComparison(field, op.text, value.text)
+}
+
+func textComparison(field filterField, op, value string, stacks *stackTable) (goroutineFilter, error) {
+	var match func(s string) bool
+	switch op {
+	case "=", "!=":
+		match = func(s string) bool { return strings.EqualFold(s, value) }
+	case "~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q; %w", value, err)
+		}
+		match = re.MatchString
+	default:
+		return nil, fmt.Errorf("operator %q is not supported by text fields", op)
+	}
+
+	negate := strings.HasPrefix(op, "!")
+	return func(gs *goroutineStat, _ trace.Time) bool {
+		for s := range field.text(gs, stacks) {
+			if match(s) {
+				return !negate
+			}
+		}
+		return negate
+	}, nil
+}
+
+func numberComparison(field filterField, op, value string) (goroutineFilter, error) {
+	if op == "~" || op == "!~" {
+		return nil, fmt.Errorf("operator %q is not supported by numeric fields", op)
+	}
+	v, err := field.parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(gs *goroutineStat, now trace.Time) bool {
+		c := cmp.Compare(field.number(gs, now), v)
+		switch op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		case "<":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}, nil
+}
+
+// keyword consumes the next token if it is the given keyword or parenthesis
+func (p *filterParser) keyword(kw string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next() (filterToken, bool) {
+	if p.pos == len(p.tokens) {
+		return filterToken{}, false
+	}
+	p.pos++
+	return p.tokens[p.pos-1], true
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	offset := -1
+	if p.pos < len(p.tokens) {
+		offset = p.tokens[p.pos].offset
+	}
+	if offset < 0 {
+		return fmt.Errorf(format+" at the end", args...)
+	}
+	return fmt.Errorf(format+" at %d", append(args, offset)...)
+}
+
+// tokenizeFilter splits the expression into parentheses, operators, quoted strings and words
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var ret []filterToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			ret = append(ret, filterToken{text: string(c), offset: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d; %w", i, err)
+			}
+			ret = append(ret, filterToken{text: text, quoted: true, offset: i})
+			i = end + 1
+		default:
+			if op := operatorAt(expr[i:]); op != "" {
+				ret = append(ret, filterToken{text: op, offset: i})
+				i += len(op)
+				continue
+			}
+			end := i
+			for end < len(expr) && !isFilterDelimiter(expr[end:]) {
+				end++
+			}
+			ret = append(ret, filterToken{text: expr[i:end], offset: i})
+			i = end
+		}
+	}
+
+	return ret, nil
+}
+
+func operatorAt(s string) string {
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isFilterDelimiter(s string) bool {
+	c := rune(s[0])
+	return unicode.IsSpace(c) || c == '(' || c == ')' || c == '"' || operatorAt(s) != ""
+}
+
+func parseFilterInt(value string) (int64, error) {
+	ret, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return ret, nil
+}
+
+func parseFilterDuration(value string) (int64, error) {
+	ret, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return int64(ret), nil
+}
+
+func single(s string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		yield(s)
+	}
+}
+
+// frameParts iterates over parts of frames of the goroutine's stacks, the part is taken from every frame by the given
+// function
+func frameParts(gs *goroutineStat, stacks *stackTable, part func(f object.StackFrame) string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, stack := range []stackID{gs.transitionStack, gs.stack} {
+			for _, frame := range stacks.frames(stack) {
+				if !yield(part(frame)) {
+					return
+				}
+			}
+		}
+	}
+}
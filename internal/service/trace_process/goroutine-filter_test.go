@@ -0,0 +1,89 @@
+package trace_process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestGoroutineFilter(t *testing.T) {
+	now := trace.Time(100 * time.Second)
+	stacks := newStackTable()
+	stat := &goroutineStat{
+		gID:       42,
+		firstSeen: trace.Time(10 * time.Second),
+		stack: stacks.internFrames([]object.StackFrame{
+			newStackFrame(0x1, "pkg/worker.Start", "/src/pkg/worker/worker.go", 10),
+		}),
+		transitionStack: stacks.internFrames([]object.StackFrame{
+			newStackFrame(0x2, "database/sql.(*DB).connectionOpener", "/go/src/database/sql/sql.go", 1218),
+		}),
+		state:        trace.GoWaiting,
+		waitReason:   "chan receive",
+		execDuration: 2 * time.Second,
+		lastRunning:  trace.Time(20 * time.Second),
+		lastStop:     trace.Time(60 * time.Second),
+		blockCount:   3,
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{`idle > 30s and stack ~ "database/sql" and creator ~ pkg/worker.Start`, true},
+		{"idle > 50s", false},
+		{"idle >= 40s and idle <= 40s and idle = 40s", true},
+		{"exec < 1s or lifetime > 1m", true},
+		{"not (exec < 1s or lifetime > 1m)", false},
+		{"state = waiting and reason = \"chan receive\"", true},
+		{"state != Waiting", false},
+		{"func ~ ^database/sql\\. and file ~ worker.go:10$", true},
+		{"func = pkg/worker.Start", true},
+		{"func !~ worker", false},
+		{"id=42 and blocks>2", true},
+		{"ID != 42 OR NOT blocks < 3", true},
+	}
+	for _, test := range tests {
+		match, err := compileGoroutineFilter(test.expr, &stacks)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.match, match(stat, now), test.expr)
+	}
+
+	for _, expr := range []string{
+		"idle >", "idle > soon", "unknown = 1", "stack > 1", "exec ~ 1s", "(idle > 1s", "idle > 1s)", `stack ~ "(`,
+		`stack ~ "unterminated`, "idle > 1s and", "idle 1s",
+	} {
+		_, err := compileGoroutineFilter(expr, &stacks)
+		assert.ErrorIs(t, err, apiError.ErrInvalidFilter, expr)
+	}
+}
+
+func TestGoroutines(t *testing.T) {
+	tp, err := NewTraceProcessor("test")
+	require.NoError(t, err)
+	for gID := range trace.GoID(10) {
+		tp.livingStats[gID] = &goroutineStat{gID: gID, state: trace.GoRunnable, group: tp.stackGroup(noStack, noStack)}
+	}
+	tp.terminatedStats[10] = &goroutineStat{gID: 10, state: trace.GoNotExist, group: tp.stackGroup(noStack, noStack)}
+
+	gors, err := tp.Goroutines("id >= 5", 0)
+	require.NoError(t, err)
+	require.Len(t, gors, 6)
+	assert.Equal(t, trace.GoID(5), gors[0].ID)
+	assert.Equal(t, trace.GoID(10), gors[5].ID)
+
+	gors, err = tp.Goroutines("state = NotExist or id < 3", 2)
+	require.NoError(t, err)
+	require.Len(t, gors, 2)
+	assert.Equal(t, trace.GoID(0), gors[0].ID)
+
+	_, err = tp.Goroutines("id >", 0)
+	assert.ErrorIs(t, err, apiError.ErrInvalidFilter)
+}
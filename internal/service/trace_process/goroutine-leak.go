@@ -0,0 +1,112 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// defaultLeakGrowthPoints is a number of points describing how a leaking group has been growing
+const defaultLeakGrowthPoints = 10
+
+type (
+	leakKey struct {
+		stack   stackID
+		created bool
+	}
+
+	leakGroup struct {
+		key     leakKey
+		members []*goroutineStat
+	}
+)
+
+// GoroutineLeaks returns groups of goroutines living longer than threshold, grouped by the stack they were created
+// with. If threshold is not positive, the configured leak threshold is used
+func (tip *TraceProcess) GoroutineLeaks(threshold time.Duration) []object.GoroutineLeak {
+	if threshold <= 0 {
+		threshold = tip.cfg.leakThreshold
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	groups := make(map[leakKey]*leakGroup)
+	add := func(stat *goroutineStat) {
+		if tip.lastEventTime.Sub(stat.firstSeen) < threshold {
+			return
+		}
+
+		key := leakKey{stack: stat.transitionStack, created: stat.created}
+		group, ok := groups[key]
+		if !ok {
+			group = &leakGroup{key: key}
+			groups[key] = group
+		}
+		group.members = append(group.members, stat)
+	}
+	for _, stat := range tip.livingStats {
+		add(stat)
+	}
+	// Stale goroutines haven't been seen for a long time, they are likely leaked
+	for _, stale := range tip.staleStats {
+		add(stale.asStat())
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	ret := make([]object.GoroutineLeak, 0, len(groups))
+	for _, group := range groups {
+		ret = append(ret, tip.convertLeakGroup(group))
+	}
+	slices.SortFunc(ret, func(a, b object.GoroutineLeak) int {
+		return b.Count - a.Count
+	})
+
+	return ret
+}
+
+func (tip *TraceProcess) convertLeakGroup(group *leakGroup) object.GoroutineLeak {
+	slices.SortFunc(group.members, func(a, b *goroutineStat) int {
+		return cmp.Compare(a.firstSeen, b.firstSeen)
+	})
+	oldest, newest := group.members[0], group.members[len(group.members)-1]
+
+	ret := object.GoroutineLeak{
+		CreationStack: tip.stacks.rendered(group.key.stack),
+		CreationSeen:  group.key.created,
+		Count:         len(group.members),
+		OldestAge:     tip.lastEventTime.Sub(oldest.firstSeen),
+		Oldest:        tip.convertStatToTop(oldest),
+	}
+	if span := newest.firstSeen.Sub(oldest.firstSeen); span > 0 {
+		ret.GrowthPerMinute = float64(len(group.members)-1) / span.Minutes()
+	}
+
+	// Every growth point shows how many of the current members had been created by that time. Points are evenly
+	// distributed between the oldest member creation and the last event
+	step := ret.OldestAge / defaultLeakGrowthPoints
+	if step <= 0 {
+		ret.Growth = []object.LeakGrowthPoint{{Count: ret.Count}}
+		return ret
+	}
+	ret.Growth = make([]object.LeakGrowthPoint, 0, defaultLeakGrowthPoints)
+	for i := defaultLeakGrowthPoints - 1; i >= 0; i-- {
+		ago := step * time.Duration(i)
+		until := tip.lastEventTime - trace.Time(ago)
+		count, _ := slices.BinarySearchFunc(group.members, until, func(stat *goroutineStat, t trace.Time) int {
+			if stat.firstSeen <= t {
+				return -1
+			}
+			return 1
+		})
+		ret.Growth = append(ret.Growth, object.LeakGrowthPoint{Ago: ago, Count: count})
+	}
+
+	return ret
+}
@@ -0,0 +1,129 @@
+package trace_process
+
+import (
+	"fmt"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// defaultRankedGoroutines is a number of goroutines returned by a ranking if it is not specified
+const defaultRankedGoroutines = 100
+
+type rankKind int
+
+const (
+	rankExec rankKind = iota
+	rankIdle
+	rankSchedLatency
+	rankBlocks
+	rankLifetime
+	rankKinds
+)
+
+var rankKindsByName = map[object.RankBy]rankKind{
+	object.RankByExec:         rankExec,
+	object.RankByIdle:         rankIdle,
+	object.RankBySchedLatency: rankSchedLatency,
+	object.RankByBlocks:       rankBlocks,
+	object.RankByLifetime:     rankLifetime,
+}
+
+// TopGoroutines returns n living goroutines matching the filter ranked by the given statistic, the greatest values go
+// first unless ascending is true. If n is not positive, defaultRankedGoroutines is used. Execution time of a running
+// goroutine is ranked as of its last stop
+func (tip *TraceProcess) TopGoroutines(
+	by object.RankBy, n int, ascending bool, filter string,
+) ([]object.TopGoroutine, error) {
+	kind, ok := rankKindsByName[by]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", apiError.ErrUnknownRanking, by)
+	}
+	match, err := compileGoroutineFilter(filter, &tip.stacks)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		n = defaultRankedGoroutines
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	stats := tip.ranks[kind].descend()
+	if ascending {
+		stats = tip.ranks[kind].ascend()
+	}
+	ret := make([]object.TopGoroutine, 0, min(n, tip.ranks[kind].len))
+	for stat := range stats {
+		if len(ret) == n {
+			break
+		}
+		if match(stat, tip.lastEventTime) {
+			ret = append(ret, tip.convertStatToTop(stat))
+		}
+	}
+
+	return ret, nil
+}
+
+// topRanked returns n living goroutines with the greatest values of the statistic
+func (tip *TraceProcess) topRanked(kind rankKind, n int) []object.TopGoroutine {
+	ret := make([]object.TopGoroutine, 0, min(n, tip.ranks[kind].len))
+	for stat := range tip.ranks[kind].descend() {
+		if len(ret) == n {
+			break
+		}
+		ret = append(ret, tip.convertStatToTop(stat))
+	}
+
+	return ret
+}
+
+// rankValue returns a value the goroutine is ranked by, false is returned if the goroutine is not ranked. Values grow
+// along with the statistic, so idle time and lifetime are ranked by negated times of their beginning
+func (gs *goroutineStat) rankValue(kind rankKind) (int64, bool) {
+	switch kind {
+	case rankExec:
+		return int64(gs.execDuration), true
+	case rankIdle:
+		return -int64(gs.lastStop), gs.lastRunning < gs.lastStop
+	case rankSchedLatency:
+		return int64(gs.schedLatency), true
+	case rankBlocks:
+		return int64(gs.blockCount), true
+	case rankLifetime:
+		return -int64(gs.firstSeen), true
+	default:
+		return 0, false
+	}
+}
+
+// updateRanks moves the goroutine within rankings whose values have changed
+func (tip *TraceProcess) updateRanks(stat *goroutineStat) {
+	for kind := range rankKinds {
+		value, ok := stat.rankValue(kind)
+		ranked := stat.ranked[kind]
+		if ranked && ok && value == stat.rankValues[kind] {
+			continue
+		}
+
+		if ranked {
+			tip.ranks[kind].delete(rankKey{value: stat.rankValues[kind], gID: stat.gID})
+		}
+		if ok {
+			tip.ranks[kind].insert(rankKey{value: value, gID: stat.gID}, stat)
+		}
+		stat.rankValues[kind], stat.ranked[kind] = value, ok
+	}
+}
+
+// removeRanks removes the goroutine from all rankings
+func (tip *TraceProcess) removeRanks(stat *goroutineStat) {
+	for kind := range rankKinds {
+		if stat.ranked[kind] {
+			tip.ranks[kind].delete(rankKey{value: stat.rankValues[kind], gID: stat.gID})
+			stat.ranked[kind] = false
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package trace_process
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultGoroutineSeriesResolution and defaultGoroutineSeriesPoints define resolution and depth of the goroutine
+	// series
+	defaultGoroutineSeriesResolution = time.Second
+	defaultGoroutineSeriesPoints     = 3600
+)
+
+// Indexes of counted goroutine states
+const (
+	seriesRunning = iota
+	seriesRunnable
+	seriesWaiting
+	seriesSyscall
+	seriesStates
+)
+
+type (
+	// goroutineSeries contains numbers of goroutines by states, they are sampled into slots of a fixed duration
+	goroutineSeries struct {
+		counts [seriesStates]int
+		slots  []goroutineSlot
+	}
+
+	goroutineSlot struct {
+		start trace.Time
+		// counts are the numbers at the end of the slot
+		counts      [seriesStates]int
+		maxRunnable int
+		created     int
+		terminated  int
+	}
+
+	seriesConfig struct {
+		resolution time.Duration
+		points     int
+	}
+)
+
+// WithGoroutineSeries sets how numbers of goroutines in every state are sampled: every point covers resolution, the
+// number of points is limited by points
+func WithGoroutineSeries(resolution time.Duration, points int) Option {
+	return func(tp *TraceProcess) {
+		if resolution > 0 && points > 0 {
+			tp.cfg.goroutineSeries = seriesConfig{resolution: resolution, points: points}
+		}
+	}
+}
+
+// GoroutineSeries returns numbers of goroutines in every state along with creations and terminations within the
+// window ending at the last event. If window is not positive, all collected points are returned
+func (tip *TraceProcess) GoroutineSeries(window time.Duration) object.GoroutineSeries {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	resolution := tip.cfg.goroutineSeries.resolution
+	from := tip.lastEventTime - trace.Time(window)
+	ret := object.GoroutineSeries{Window: window, Resolution: resolution}
+	for _, slot := range tip.gorSeries.slots {
+		if window > 0 && slot.start+trace.Time(resolution) <= from {
+			continue
+		}
+
+		point := object.GoroutineCountPoint{
+			Time:        slot.start,
+			Interval:    resolution,
+			Running:     slot.counts[seriesRunning],
+			Runnable:    slot.counts[seriesRunnable],
+			Waiting:     slot.counts[seriesWaiting],
+			Syscall:     slot.counts[seriesSyscall],
+			MaxRunnable: slot.maxRunnable,
+			Created:     slot.created,
+			Terminated:  slot.terminated,
+		}
+		for _, count := range slot.counts {
+			point.Living += count
+		}
+		ret.Points = append(ret.Points, point)
+	}
+
+	return ret
+}
+
+// changeGoroutineState counts a goroutine transition in the goroutine series
+func (tip *TraceProcess) changeGoroutineState(from, to trace.GoState, now trace.Time) {
+	// The slot is taken before counting, so slots created for the gap get the counts before the transition
+	slot := tip.goroutineSlot(now)
+	gs := &tip.gorSeries
+	if from != to {
+		if idx, ok := seriesIndex(from); ok {
+			gs.counts[idx] = max(gs.counts[idx]-1, 0)
+		}
+		if idx, ok := seriesIndex(to); ok {
+			gs.counts[idx]++
+		}
+	}
+	if slot == nil {
+		return
+	}
+	slot.counts = gs.counts
+	slot.maxRunnable = max(slot.maxRunnable, gs.counts[seriesRunnable])
+	switch {
+	case from == trace.GoNotExist && to != trace.GoNotExist:
+		slot.created++
+	case from != trace.GoNotExist && to == trace.GoNotExist:
+		slot.terminated++
+	}
+}
+
+// resetGoroutineCounts forgets states of all goroutines, they are counted again when the next stream reports them
+func (tip *TraceProcess) resetGoroutineCounts(now trace.Time) {
+	tip.gorSeries.counts = [seriesStates]int{}
+	if slot := tip.goroutineSlot(now); slot != nil {
+		slot.counts = tip.gorSeries.counts
+	}
+}
+
+// goroutineSlot returns a slot containing "at", new slots are created if "at" is after the last one. Slots without
+// transitions repeat the current counts. Nil is returned if "at" is before the last slot
+func (tip *TraceProcess) goroutineSlot(at trace.Time) *goroutineSlot {
+	gs := &tip.gorSeries
+	cfg := tip.cfg.goroutineSeries
+	resolution := trace.Time(cfg.resolution)
+	start := at - at%resolution
+	last := len(gs.slots) - 1
+	if last >= 0 && gs.slots[last].start >= start {
+		if gs.slots[last].start == start {
+			return &gs.slots[last]
+		}
+		return nil
+	}
+
+	next := start
+	if last >= 0 {
+		next = gs.slots[last].start + resolution
+	}
+	added := int((start-next)/resolution) + 1
+	if added > cfg.points {
+		next, added = start-resolution*trace.Time(cfg.points-1), cfg.points
+	}
+	if drop := len(gs.slots) + added - cfg.points; drop > 0 {
+		gs.slots = append(gs.slots[:0], gs.slots[drop:]...)
+	}
+	for ; next <= start; next += resolution {
+		gs.slots = append(gs.slots, goroutineSlot{start: next, counts: gs.counts, maxRunnable: gs.counts[seriesRunnable]})
+	}
+
+	return &gs.slots[len(gs.slots)-1]
+}
+
+func seriesIndex(state trace.GoState) (int, bool) {
+	switch state {
+	case trace.GoRunning:
+		return seriesRunning, true
+	case trace.GoRunnable:
+		return seriesRunnable, true
+	case trace.GoWaiting:
+		return seriesWaiting, true
+	case trace.GoSyscall:
+		return seriesSyscall, true
+	default:
+		return 0, false
+	}
+}
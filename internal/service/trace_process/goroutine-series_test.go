@@ -0,0 +1,76 @@
+package trace_process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/trace"
+)
+
+func TestGoroutineSeries(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	data := collectTrace(t, func() {
+		for range 20 {
+			go leakingWorker(release)
+		}
+		for range 10 {
+			go spin(time.Millisecond)
+		}
+		// The trace spans several generations
+		time.Sleep(1200 * time.Millisecond)
+	})
+	tp := processTrace(t, data, WithGoroutineSeries(100*time.Millisecond, 100))
+
+	series := tp.GoroutineSeries(0)
+	assert.Equal(t, 100*time.Millisecond, series.Resolution)
+	require.GreaterOrEqual(t, len(series.Points), 12)
+	var created, terminated int
+	for i, point := range series.Points {
+		created += point.Created
+		terminated += point.Terminated
+		assert.Equal(t, point.Running+point.Runnable+point.Waiting+point.Syscall, point.Living)
+		assert.GreaterOrEqual(t, point.MaxRunnable, point.Runnable)
+		if i > 0 {
+			assert.Equal(t, series.Points[i-1].Time+trace.Time(100*time.Millisecond), point.Time)
+		}
+	}
+	assert.GreaterOrEqual(t, created, 30)
+	assert.GreaterOrEqual(t, terminated, 10)
+
+	// The last point matches the states of living goroutines
+	states := make(map[trace.GoState]int)
+	for _, stat := range tp.livingStats {
+		states[stat.state]++
+	}
+	last := series.Points[len(series.Points)-1]
+	assert.Equal(t, states[trace.GoWaiting], last.Waiting)
+	assert.Equal(t, states[trace.GoRunning], last.Running)
+	assert.GreaterOrEqual(t, last.Waiting, 20)
+
+	// The oldest point covers the window partially
+	assert.Len(t, tp.GoroutineSeries(300*time.Millisecond).Points, 4)
+}
+
+func TestGoroutineSlots(t *testing.T) {
+	tp, err := NewTraceProcessor("test", WithGoroutineSeries(time.Second, 3))
+	require.NoError(t, err)
+
+	tp.changeGoroutineState(trace.GoNotExist, trace.GoRunnable, trace.Time(500*time.Millisecond))
+	tp.changeGoroutineState(trace.GoRunnable, trace.GoRunning, trace.Time(1500*time.Millisecond))
+	require.Len(t, tp.gorSeries.slots, 2)
+	assert.Equal(t, 1, tp.gorSeries.slots[0].counts[seriesRunnable])
+	assert.Equal(t, 1, tp.gorSeries.slots[1].maxRunnable)
+	assert.Equal(t, 1, tp.gorSeries.slots[1].counts[seriesRunning])
+
+	// Slots without transitions repeat the counts, the oldest slots are dropped
+	tp.changeGoroutineState(trace.GoRunning, trace.GoNotExist, trace.Time(10*time.Second))
+	require.Len(t, tp.gorSeries.slots, 3)
+	assert.Equal(t, trace.Time(8*time.Second), tp.gorSeries.slots[0].start)
+	assert.Equal(t, 1, tp.gorSeries.slots[1].counts[seriesRunning])
+	assert.Zero(t, tp.gorSeries.slots[2].counts[seriesRunning])
+	assert.Equal(t, 1, tp.gorSeries.slots[2].terminated)
+	assert.Nil(t, tp.goroutineSlot(trace.Time(5*time.Second)))
+}
@@ -0,0 +1,139 @@
+package trace_process
+
+import (
+	"slices"
+
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultGoroutineHistory is a number of the latest state transitions kept for every goroutine
+	defaultGoroutineHistory = 100
+	// defaultTerminatedGoroutineHistory is a number of the latest state transitions kept for every terminated goroutine
+	defaultTerminatedGoroutineHistory = 10
+	// defaultBlockingSites is a number of the latest distinct stacks kept for every goroutine where it has blocked
+	defaultBlockingSites = 5
+	// disconnectedReason is a reason of transitions to the undetermined state when a stream ends
+	disconnectedReason = "disconnected"
+)
+
+type goroutineTransition struct {
+	time     trace.Time
+	from, to trace.GoState
+	reason   string
+	stack    stackID
+	proc     trace.ProcID
+}
+
+// WithGoroutineHistory sets a number of the latest state transitions kept for every goroutine
+func WithGoroutineHistory(transitions int) Option {
+	return func(tp *TraceProcess) {
+		if transitions > 0 {
+			tp.cfg.goroutineHistory = transitions
+		}
+	}
+}
+
+// WithBlockingSites sets a number of the latest distinct stacks kept for every goroutine where it has blocked
+func WithBlockingSites(sites int) Option {
+	return func(tp *TraceProcess) {
+		if sites > 0 {
+			tp.cfg.blockingSites = sites
+		}
+	}
+}
+
+// GoroutineTimeline returns the lifecycle of a living or terminated goroutine: its state transitions and run slices
+func (tip *TraceProcess) GoroutineTimeline(gID trace.GoID) (object.GoroutineTimeline, error) {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	stat, ok := tip.livingStats[gID]
+	if !ok {
+		stat, ok = tip.terminatedStats[gID]
+	}
+	if !ok {
+		stale, ok := tip.staleStats[gID]
+		if !ok {
+			return object.GoroutineTimeline{}, apiError.ErrGoroutineNotFound
+		}
+		stat = stale.asStat()
+	}
+
+	ret := object.GoroutineTimeline{
+		Goroutine:          tip.convertStatToTop(stat),
+		State:              stat.state.String(),
+		Created:            stat.created,
+		FirstSeen:          stat.firstSeen,
+		Transitions:        make([]object.GoroutineTransition, 0, stat.history.len()),
+		DroppedTransitions: stat.transitions - stat.history.len(),
+	}
+	for _, stack := range stat.blockingSites {
+		ret.BlockingSites = append(ret.BlockingSites, tip.stacks.rendered(stack))
+		ret.BlockingSiteIDs = append(ret.BlockingSiteIDs, int(stack))
+	}
+	var running *object.RunSlice
+	for tr := range stat.history.all() {
+		transition := object.GoroutineTransition{
+			Time:   tr.time,
+			From:   tr.from.String(),
+			To:     tr.to.String(),
+			Reason: tr.reason,
+		}
+		if tr.stack != noStack {
+			transition.Stack, transition.StackID = tip.stacks.rendered(tr.stack), int(tr.stack)
+		}
+		ret.Transitions = append(ret.Transitions, transition)
+
+		if tr.from == trace.GoRunning && tr.to != trace.GoRunning && running != nil {
+			running.End, running.Duration = tr.time, tr.time.Sub(running.Start)
+			ret.RunSlices = append(ret.RunSlices, *running)
+			running = nil
+		}
+		if tr.to == trace.GoRunning && running == nil {
+			running = &object.RunSlice{Start: tr.time, Proc: tr.proc}
+		}
+	}
+	if running != nil {
+		running.End, running.Duration, running.Ongoing = tip.lastEventTime, tip.lastEventTime.Sub(running.Start), true
+		ret.RunSlices = append(ret.RunSlices, *running)
+	}
+
+	return ret, nil
+}
+
+// recordTransition adds the transition to the goroutine's history, status events reporting the same state are not
+// recorded
+func (tip *TraceProcess) recordTransition(stat *goroutineStat, tr goroutineTransition) {
+	if stat.history.len() == 0 {
+		stat.history = newRing[goroutineTransition](tip.cfg.goroutineHistory)
+	}
+	stat.history.add(tr)
+	stat.transitions++
+}
+
+// addBlockingSite makes the stack the goroutine's latest blocking stack. The stack is moved to the end of the
+// blocking sites if the goroutine has already blocked there, otherwise the oldest site is dropped when there are too
+// many of them
+func (tip *TraceProcess) addBlockingSite(stat *goroutineStat, stack stackID) {
+	if i := slices.Index(stat.blockingSites, stack); i >= 0 {
+		stat.blockingSites = append(slices.Delete(stat.blockingSites, i, i+1), stack)
+		return
+	}
+
+	if len(stat.blockingSites) >= tip.cfg.blockingSites {
+		stat.blockingSites = slices.Delete(stat.blockingSites, 0, len(stat.blockingSites)-tip.cfg.blockingSites+1)
+	}
+	stat.blockingSites = append(stat.blockingSites, stack)
+}
+
+// blockingStack returns the stack the goroutine has blocked at the last time
+func (gs *goroutineStat) blockingStack() stackID {
+	if len(gs.blockingSites) == 0 {
+		return noStack
+	}
+	return gs.blockingSites[len(gs.blockingSites)-1]
+}
@@ -0,0 +1,164 @@
+package trace_process
+
+import (
+	"math/bits"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// histogramSubBits is a number of bits defining how many sub-buckets every power of two range is split into.
+	// 2 bits give 4 sub-buckets, so the relative error of a bucket bound is 25% at most
+	histogramSubBits    = 2
+	histogramSubBuckets = 1 << histogramSubBits
+
+	// defaultHistogramSlotDuration and defaultHistogramSlots define how long latency histograms are kept: every slot
+	// keeps samples of defaultHistogramSlotDuration, the oldest slot is dropped when the number of slots exceeds
+	// defaultHistogramSlots
+	defaultHistogramSlotDuration = time.Minute
+	defaultHistogramSlots        = 60
+)
+
+type (
+	// latencyHistogram is a log-linear histogram. Values less than histogramSubBuckets have their own buckets, every
+	// power of two range above is split into histogramSubBuckets buckets
+	latencyHistogram struct {
+		counts []uint32
+		count  int64
+		sum    time.Duration
+		max    time.Duration
+	}
+
+	// windowedHistogram keeps latency histograms by time slots so that a distribution within a time window can be got
+	windowedHistogram struct {
+		slots []histogramSlot
+	}
+
+	histogramSlot struct {
+		start trace.Time
+		hist  latencyHistogram
+	}
+
+	histogramConfig struct {
+		slotDuration time.Duration
+		slots        int
+	}
+)
+
+func histogramBucket(value time.Duration) int {
+	if value < histogramSubBuckets {
+		return int(max(value, 0))
+	}
+
+	exp := bits.Len64(uint64(value)) - 1
+	sub := int(uint64(value)>>(exp-histogramSubBits)) & (histogramSubBuckets - 1)
+	return histogramSubBuckets + (exp-histogramSubBits)*histogramSubBuckets + sub
+}
+
+// histogramUpperBound returns the maximum value falling into the bucket
+func histogramUpperBound(bucket int) time.Duration {
+	if bucket < histogramSubBuckets {
+		return time.Duration(bucket)
+	}
+
+	exp := (bucket-histogramSubBuckets)/histogramSubBuckets + histogramSubBits
+	sub := (bucket - histogramSubBuckets) % histogramSubBuckets
+	lower := uint64(histogramSubBuckets+sub) << (exp - histogramSubBits)
+	return time.Duration(lower + 1<<(exp-histogramSubBits) - 1)
+}
+
+func (h *latencyHistogram) add(value time.Duration) {
+	bucket := histogramBucket(value)
+	if bucket >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint32, bucket-len(h.counts)+1)...)
+	}
+	h.counts[bucket]++
+	h.count++
+	h.sum += value
+	h.max = max(h.max, value)
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint32, len(other.counts)-len(h.counts))...)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.count += other.count
+	h.sum += other.sum
+	h.max = max(h.max, other.max)
+}
+
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int64(q*float64(h.count) + 0.5)
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += int64(c)
+		if cumulative >= max(rank, 1) {
+			return min(histogramUpperBound(i), h.max)
+		}
+	}
+
+	return h.max
+}
+
+func (h *latencyHistogram) convert() object.LatencyHistogram {
+	ret := object.LatencyHistogram{Count: h.count, Max: h.max}
+	if h.count == 0 {
+		return ret
+	}
+
+	ret.Mean = h.sum / time.Duration(h.count)
+	ret.P50, ret.P90, ret.P99 = h.percentile(0.5), h.percentile(0.9), h.percentile(0.99)
+	for i, c := range h.counts {
+		if c > 0 {
+			ret.Buckets = append(ret.Buckets, object.LatencyBucket{UpperBound: histogramUpperBound(i), Count: int64(c)})
+		}
+	}
+
+	return ret
+}
+
+// add puts the value into the slot containing "at", old slots not fitting into the configured range are dropped
+func (wh *windowedHistogram) add(cfg histogramConfig, at trace.Time, value time.Duration) {
+	start := at - at%trace.Time(cfg.slotDuration)
+	last := len(wh.slots) - 1
+	if last == -1 || wh.slots[last].start < start {
+		wh.slots = append(wh.slots, histogramSlot{start: start})
+		last++
+	}
+	// Events may slightly go back in time between generations, such values are put into the last slot
+	wh.slots[last].hist.add(value)
+
+	oldest := start - trace.Time(cfg.slotDuration)*trace.Time(cfg.slots-1)
+	drop := 0
+	for drop < len(wh.slots) && wh.slots[drop].start < oldest {
+		drop++
+	}
+	if drop > 0 {
+		wh.slots = append(wh.slots[:0], wh.slots[drop:]...)
+	}
+}
+
+// histogram returns a histogram merged from slots intersecting with the window ending at "now". If window is not
+// positive, all slots are merged
+func (wh *windowedHistogram) histogram(cfg histogramConfig, now trace.Time, window time.Duration) latencyHistogram {
+	var ret latencyHistogram
+	from := now - trace.Time(window)
+	for i := range wh.slots {
+		if window > 0 && wh.slots[i].start+trace.Time(cfg.slotDuration) <= from {
+			continue
+		}
+		ret.merge(&wh.slots[i].hist)
+	}
+
+	return ret
+}
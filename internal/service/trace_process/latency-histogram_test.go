@@ -0,0 +1,53 @@
+package trace_process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/trace"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	prevBucket := -1
+	for value := time.Duration(0); value < 10_000; value++ {
+		bucket := histogramBucket(value)
+		assert.GreaterOrEqual(t, bucket, prevBucket)
+		assert.LessOrEqual(t, value, histogramUpperBound(bucket))
+		if bucket > 0 {
+			assert.Greater(t, value, histogramUpperBound(bucket-1))
+		}
+		prevBucket = bucket
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i) * time.Microsecond)
+	}
+
+	ret := h.convert()
+	assert.Equal(t, int64(1000), ret.Count)
+	assert.Equal(t, time.Millisecond, ret.Max)
+	assert.InDelta(t, 500*time.Microsecond, ret.P50, float64(125*time.Microsecond))
+	assert.InDelta(t, 990*time.Microsecond, ret.P99, float64(250*time.Microsecond))
+	assert.LessOrEqual(t, ret.P99, ret.Max)
+}
+
+func TestWindowedHistogram(t *testing.T) {
+	cfg := histogramConfig{slotDuration: time.Second, slots: 3}
+	var wh windowedHistogram
+	for i := range 5 {
+		wh.add(cfg, trace.Time(time.Duration(i)*time.Second), time.Duration(i+1)*time.Millisecond)
+	}
+
+	assert.Len(t, wh.slots, 3)
+	now := trace.Time(4 * time.Second)
+	all := wh.histogram(cfg, now, 0)
+	assert.Equal(t, int64(3), all.count)
+	// The window intersects with the last two slots
+	last := wh.histogram(cfg, now, time.Second)
+	assert.Equal(t, int64(2), last.count)
+	assert.Equal(t, 5*time.Millisecond, last.max)
+}
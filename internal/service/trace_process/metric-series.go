@@ -0,0 +1,63 @@
+package trace_process
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// defaultMetricPoints is a maximum number of points kept for every metric
+const defaultMetricPoints = 10000
+
+// Metrics returns time series of runtime metrics within the window ending at the last event. Only metrics with the
+// given names are returned, all of them are returned if names is empty. If window is not positive, all collected points
+// are returned
+func (tip *TraceProcess) Metrics(names []string, window time.Duration) []object.MetricSeries {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	from := tip.lastEventTime - trace.Time(window)
+	ret := make([]object.MetricSeries, 0, len(tip.metrics))
+	for name, series := range tip.metrics {
+		if len(names) > 0 && !slices.Contains(names, name) {
+			continue
+		}
+
+		item := object.MetricSeries{Name: name, Points: make([]object.MetricPoint, 0, series.len())}
+		for point := range series.all() {
+			if window <= 0 || point.Time >= from {
+				item.Points = append(item.Points, point)
+			}
+		}
+		ret = append(ret, item)
+	}
+	slices.SortFunc(ret, func(a, b object.MetricSeries) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return ret
+}
+
+func (tip *TraceProcess) processMetricEvent(ev *trace.Event) {
+	m := ev.Metric()
+	if m.Value.Kind() != trace.ValueUint64 {
+		return
+	}
+
+	value := m.Value.Uint64()
+	series, ok := tip.metrics[m.Name]
+	if !ok {
+		r := newRing[object.MetricPoint](tip.cfg.metricPoints)
+		series = &r
+		tip.metrics[m.Name] = series
+	}
+	series.add(object.MetricPoint{Time: tip.eventTime(ev), Value: value})
+
+	if m.Name == metricGOMAXPROCSName {
+		tip.gomaxprocs = max(int(value), 1)
+	}
+}
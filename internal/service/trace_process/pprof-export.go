@@ -0,0 +1,227 @@
+package trace_process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// waitReasonLabel is a sample label keeping a wait reason in wait profiles
+	waitReasonLabel = "wait reason"
+	// goroutineLabel and groupLabel are sample labels of CPU profiles keeping the start function of the sampled
+	// goroutine's group and the goroutine itself if samples are attributed to goroutines
+	goroutineLabel = "goroutine"
+	groupLabel     = "goroutine group"
+)
+
+type (
+	// profileSampleKey identifies a sample: the goroutine's own stack on top of its creation stack and a wait reason.
+	// CPU samples are labeled with the group and the goroutine
+	profileSampleKey struct {
+		stack, creator stackID
+		reason         string
+		gID            trace.GoID
+		group          *stackGroup
+	}
+
+	profileBuilder struct {
+		stacks    *stackTable
+		prof      *profile.Profile
+		samples   map[profileSampleKey]*profile.Sample
+		locations map[object.StackFrame]*profile.Location
+		functions map[[2]string]*profile.Function
+	}
+)
+
+// Profile returns a pprof profile of goroutine time of the given type. Samples contain stacks goroutines have started
+// with (or, for idle time, have blocked at) on top of stacks of the go statements which have created them, so flame
+// graphs show goroutines under their creators. Wait profiles keep the reason of every sample in the "wait reason"
+// label. CPU profiles are built of CPU samples of the trace within the window ending at the last event, all kept
+// samples are used if window is not positive. Goroutine time is cumulative, so window is ignored for other types
+func (tip *TraceProcess) Profile(typ object.ProfileType, window time.Duration) (*profile.Profile, error) {
+	switch typ {
+	case object.ProfileExec, object.ProfileIdle, object.ProfileWait, object.ProfileCPU:
+	default:
+		return nil, fmt.Errorf("%w: %q", apiError.ErrUnknownProfileType, typ)
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	pb := newProfileBuilder(&tip.stacks, string(typ))
+	now := tip.lastEventTime
+	switch typ {
+	case object.ProfileCPU:
+		pb.prof.SampleType = []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}
+		pb.prof.PeriodType = &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+		period := tip.cfg.cpuSamples.period
+		pb.prof.Period = int64(period)
+		tip.cpu.samples(tip.cfg.cpuSamples, now, window, func(key cpuSampleKey, count int64) {
+			sampleKey := profileSampleKey{stack: key.stack, gID: key.gID, group: key.group}
+			if key.group != nil {
+				sampleKey.creator = key.group.key.stack
+			}
+			pb.addValues(sampleKey, count, count*int64(period))
+		})
+	case object.ProfileExec:
+		tip.allStats(func(stat *goroutineStat) {
+			exec := stat.execDuration
+			if stat.state == trace.GoRunning {
+				exec += now.Sub(stat.lastRunning)
+			}
+			pb.add(profileSampleKey{stack: stat.transitionStack, creator: stat.stack}, exec)
+		})
+		for _, sg := range tip.groups {
+			key := profileSampleKey{stack: sg.key.transitionStack, creator: sg.key.stack}
+			pb.add(key, sg.stale.execDuration+sg.terminated.execDuration)
+		}
+	case object.ProfileIdle:
+		for _, stat := range tip.livingStats {
+			stack := stat.blockingStack()
+			if stack == noStack {
+				stack = stat.transitionStack
+			}
+			pb.add(profileSampleKey{stack: stack, creator: stat.stack}, stat.idleAt(now))
+		}
+	case object.ProfileWait:
+		tip.allStats(func(stat *goroutineStat) {
+			waits, _ := stat.waitDurationsAt(now)
+			for reason, d := range waits {
+				pb.add(profileSampleKey{stack: stat.transitionStack, creator: stat.stack, reason: reason}, d)
+			}
+		})
+		for _, sg := range tip.groups {
+			for _, totals := range []*evictedTotals{&sg.stale, &sg.terminated} {
+				for reason, d := range totals.waitDurations {
+					pb.add(profileSampleKey{stack: sg.key.transitionStack, creator: sg.key.stack, reason: reason}, d)
+				}
+			}
+		}
+	}
+
+	return pb.prof, nil
+}
+
+// allStats calls f for every living and terminated goroutine which hasn't been evicted
+func (tip *TraceProcess) allStats(f func(stat *goroutineStat)) {
+	for _, stat := range tip.livingStats {
+		f(stat)
+	}
+	for _, stat := range tip.terminatedStats {
+		f(stat)
+	}
+}
+
+func newProfileBuilder(stacks *stackTable, sampleType string) *profileBuilder {
+	return &profileBuilder{
+		stacks: stacks,
+		prof: &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: sampleType, Unit: "nanoseconds"}},
+			PeriodType: &profile.ValueType{Type: sampleType, Unit: "nanoseconds"},
+			Period:     1,
+			TimeNanos:  time.Now().UnixNano(),
+		},
+		samples:   make(map[profileSampleKey]*profile.Sample),
+		locations: make(map[object.StackFrame]*profile.Location),
+		functions: make(map[[2]string]*profile.Function),
+	}
+}
+
+// add adds the duration to the sample with the given key, empty durations are skipped
+func (pb *profileBuilder) add(key profileSampleKey, d time.Duration) {
+	if d > 0 {
+		pb.addValues(key, int64(d))
+	}
+}
+
+// addValues adds values to the sample with the given key, one value for every sample type
+func (pb *profileBuilder) addValues(key profileSampleKey, values ...int64) {
+	sample, ok := pb.samples[key]
+	if !ok {
+		sample = &profile.Sample{Value: make([]int64, len(pb.prof.SampleType))}
+		for _, id := range []stackID{key.stack, key.creator} {
+			for _, frame := range pb.stacks.frames(id) {
+				sample.Location = append(sample.Location, pb.location(frame))
+			}
+		}
+		if key.reason != "" {
+			sample.Label = map[string][]string{waitReasonLabel: {key.reason}}
+		}
+		if key.group != nil {
+			sample.Label = map[string][]string{groupLabel: {pb.stacks.topFunction(key.group.key.transitionStack)}}
+			if key.gID != trace.NoGoroutine {
+				sample.Label[goroutineLabel] = []string{strconv.FormatInt(int64(key.gID), 10)}
+			}
+		}
+		pb.samples[key] = sample
+		pb.prof.Sample = append(pb.prof.Sample, sample)
+	}
+	for i, value := range values {
+		sample.Value[i] += value
+	}
+}
+
+func (pb *profileBuilder) location(frame object.StackFrame) *profile.Location {
+	if loc, ok := pb.locations[frame]; ok {
+		return loc
+	}
+
+	fnKey := [2]string{frame.Function, frame.File}
+	fn, ok := pb.functions[fnKey]
+	if !ok {
+		fn = &profile.Function{
+			ID:         uint64(len(pb.prof.Function) + 1),
+			Name:       frame.Function,
+			SystemName: frame.Function,
+			Filename:   frame.File,
+		}
+		pb.functions[fnKey] = fn
+		pb.prof.Function = append(pb.prof.Function, fn)
+	}
+	loc := &profile.Location{
+		ID:      uint64(len(pb.prof.Location) + 1),
+		Address: frame.PC,
+		Line:    []profile.Line{{Function: fn, Line: int64(frame.Line)}},
+	}
+	pb.locations[frame] = loc
+	pb.prof.Location = append(pb.prof.Location, loc)
+	return loc
+}
+
+// WriteFoldedStacks writes samples of the profile to w as folded stacks for flame graph tools: every line contains
+// frames from the root to the leaf separated by semicolons and the first value of samples having these frames
+func WriteFoldedStacks(prof *profile.Profile, w io.Writer) error {
+	values := make(map[string]int64)
+	var frames []string
+	for _, sample := range prof.Sample {
+		frames = frames[:0]
+		for _, loc := range slices.Backward(sample.Location) {
+			for _, line := range slices.Backward(loc.Line) {
+				frames = append(frames, line.Function.Name)
+			}
+		}
+		if len(frames) > 0 && len(sample.Value) > 0 {
+			values[strings.Join(frames, ";")] += sample.Value[0]
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range slices.Sorted(maps.Keys(values)) {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", stack, values[stack]); err != nil {
+			return fmt.Errorf("failed to write folded stacks; %w", err)
+		}
+	}
+	return bw.Flush()
+}
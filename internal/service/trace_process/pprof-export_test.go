@@ -0,0 +1,158 @@
+package trace_process
+
+import (
+	"bytes"
+	"io"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestProfile(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		done := make(chan struct{})
+		go profiledWorker(done)
+		go leakingWorker(release)
+		<-done
+		time.Sleep(5 * time.Millisecond)
+	})
+	close(release)
+	tp := processTrace(t, data)
+
+	exec := writeAndParse(t, tp, object.ProfileExec)
+	assert.Equal(t, "exec", exec.SampleType[0].Type)
+	worker := findSample(exec, "profiledWorker")
+	require.NotNil(t, worker)
+	assert.GreaterOrEqual(t, worker.Value[0], int64(5*time.Millisecond))
+	// The creator's frames follow the goroutine's own ones
+	leaf := worker.Location[0].Line[0].Function.Name
+	assert.True(t, strings.HasSuffix(leaf, ".profiledWorker"), leaf)
+	assert.Contains(t, worker.Location[len(worker.Location)-1].Line[0].Function.Name, "collectTrace")
+
+	wait := writeAndParse(t, tp, object.ProfileWait)
+	worker = findSample(wait, "leakingWorker")
+	require.NotNil(t, worker)
+	assert.Equal(t, []string{waitReasonChanReceive}, worker.Label[waitReasonLabel])
+	assert.Positive(t, worker.Value[0])
+
+	idle := writeAndParse(t, tp, object.ProfileIdle)
+	worker = findSample(idle, "leakingWorker")
+	require.NotNil(t, worker)
+	assert.GreaterOrEqual(t, worker.Value[0], int64(5*time.Millisecond))
+	assert.Nil(t, findSample(idle, "profiledWorker"), "terminated goroutines aren't idle")
+
+	_, err := tp.Profile("heap", 0)
+	assert.ErrorIs(t, err, apiError.ErrUnknownProfileType)
+}
+
+func profiledWorker(done chan struct{}) {
+	spin(5 * time.Millisecond)
+	close(done)
+}
+
+func writeAndParse(tb testing.TB, tp *TraceProcess, typ object.ProfileType) *profile.Profile {
+	tb.Helper()
+
+	prof, err := tp.Profile(typ, 0)
+	require.NoError(tb, err)
+	var buf bytes.Buffer
+	require.NoError(tb, prof.Write(&buf))
+	ret, err := profile.Parse(&buf)
+	require.NoError(tb, err)
+	require.NoError(tb, ret.CheckValid())
+	return ret
+}
+
+// findSample returns a sample having the function in any of its frames
+func findSample(prof *profile.Profile, function string) *profile.Sample {
+	for _, sample := range prof.Sample {
+		if slices.ContainsFunc(sample.Location, func(loc *profile.Location) bool {
+			return strings.Contains(loc.Line[0].Function.Name, function)
+		}) {
+			return sample
+		}
+	}
+	return nil
+}
+
+func TestCPUProfile(t *testing.T) {
+	data := collectTrace(t, func() {
+		require.NoError(t, pprof.StartCPUProfile(io.Discard))
+		done := make(chan struct{})
+		go cpuWorker(done)
+		<-done
+		pprof.StopCPUProfile()
+	})
+	tp := processTrace(t, data)
+
+	prof := writeAndParse(t, tp, object.ProfileCPU)
+	assert.Equal(t, "cpu", prof.SampleType[1].Type)
+	worker := findSample(prof, "cpuWorker")
+	require.NotNil(t, worker)
+	assert.Positive(t, worker.Value[0])
+	assert.Equal(t, worker.Value[0]*int64(defaultCPUSamplePeriod), worker.Value[1])
+	require.Len(t, worker.Label[groupLabel], 1)
+	assert.True(t, strings.HasSuffix(worker.Label[groupLabel][0], ".cpuWorker"))
+	// Samples are attributed to goroutines only on demand
+	assert.Empty(t, worker.Label[goroutineLabel])
+
+	tp = processTrace(t, data, WithCPUSampleGoroutines(true), WithCPUSamplePeriod(time.Millisecond))
+	perGoroutine := findSample(writeAndParse(t, tp, object.ProfileCPU), "cpuWorker")
+	require.NotNil(t, perGoroutine)
+	gID := findGoroutine(t, tp, "cpuWorker")
+	assert.Equal(t, []string{strconv.FormatInt(int64(gID), 10)}, perGoroutine.Label[goroutineLabel])
+	assert.Equal(t, perGoroutine.Value[0]*int64(time.Millisecond), perGoroutine.Value[1])
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFoldedStacks(prof, &buf))
+	var found bool
+	for line := range strings.Lines(buf.String()) {
+		stack, count, ok := strings.Cut(strings.TrimSpace(line), " ")
+		require.True(t, ok, line)
+		n, err := strconv.Atoi(count)
+		require.NoError(t, err)
+		assert.Positive(t, n)
+		// Frames go from the root, so the creator's frames come first
+		if strings.Contains(stack, ".cpuWorker;") {
+			found = true
+			assert.Less(t, strings.Index(stack, "collectTrace"), strings.Index(stack, "cpuWorker"))
+		}
+	}
+	assert.True(t, found, buf.String())
+}
+
+func TestCPUSampleWindow(t *testing.T) {
+	cfg := cpuProfileConfig{slotDuration: time.Second, slots: 3}
+	var cp cpuProfile
+	key := cpuSampleKey{stack: 1, gID: 1}
+	for _, at := range []time.Duration{0, 500 * time.Millisecond, 2 * time.Second, 4 * time.Second} {
+		cp.add(cfg, trace.Time(at), key)
+	}
+	// The slot of the first two samples is dropped
+	require.Len(t, cp.slots, 2)
+
+	count := func(window time.Duration) (ret int64) {
+		cp.samples(cfg, trace.Time(4500*time.Millisecond), window, func(_ cpuSampleKey, count int64) { ret += count })
+		return
+	}
+	assert.Equal(t, int64(2), count(0))
+	assert.Equal(t, int64(1), count(time.Second))
+}
+
+//go:noinline
+func cpuWorker(done chan struct{}) {
+	spin(200 * time.Millisecond)
+	close(done)
+}
@@ -0,0 +1,225 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultProcSlotDuration and defaultProcSlots define resolution and depth of utilization series
+	defaultProcSlotDuration = time.Second
+	defaultProcSlots        = 3600
+	// defaultProcIntervals is a number of the latest busy intervals kept for every P
+	defaultProcIntervals = 1000
+)
+
+type (
+	// procStat contains utilization of Ps and OS threads
+	procStat struct {
+		procs map[trace.ProcID]*procTimeline
+		slots []procSlot
+		// slotThreads contains threads seen within the last slot
+		slotThreads map[trace.ThreadID]struct{}
+		// syscalls is a number of goroutines being in syscalls now
+		syscalls int
+	}
+
+	procTimeline struct {
+		id    trace.ProcID
+		state trace.ProcState
+		// lastStart is the time when the P was switched to Running
+		lastStart trace.Time
+		busy      time.Duration
+		intervals ring[object.TimeRange]
+	}
+
+	procSlot struct {
+		start       trace.Time
+		busy        time.Duration
+		gomaxprocs  int
+		threads     int
+		maxSyscalls int
+		steals      int
+	}
+)
+
+func newProcStat() procStat {
+	return procStat{
+		procs:       make(map[trace.ProcID]*procTimeline),
+		slotThreads: make(map[trace.ThreadID]struct{}),
+	}
+}
+
+// ProcReport returns utilization of Ps and OS threads within the window ending at the last event. If window is not
+// positive, all collected data is used
+func (tip *TraceProcess) ProcReport(window time.Duration) object.ProcReport {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	ps := &tip.procs
+	now := tip.lastEventTime
+	from := now - trace.Time(window)
+	if window <= 0 && len(ps.slots) > 0 {
+		from = ps.slots[0].start
+	}
+	span := now.Sub(from)
+
+	ret := object.ProcReport{Window: window, GOMAXPROCS: tip.gomaxprocs}
+	var totalBusy time.Duration
+	for _, p := range ps.procs {
+		timeline := object.ProcTimeline{ID: p.id, State: p.state.String()}
+		for interval := range p.intervals.all() {
+			if interval.End > from {
+				timeline.Busy = append(timeline.Busy, interval)
+				timeline.BusyDuration += interval.End.Sub(max(interval.Start, from))
+			}
+		}
+		if p.state == trace.ProcRunning {
+			timeline.Busy = append(timeline.Busy, object.TimeRange{Start: p.lastStart, End: now})
+			timeline.BusyDuration += now.Sub(max(p.lastStart, from))
+		}
+		if span > 0 {
+			timeline.Utilization = float64(timeline.BusyDuration) / float64(span)
+		}
+		totalBusy += timeline.BusyDuration
+		ret.Procs = append(ret.Procs, timeline)
+	}
+	slices.SortFunc(ret.Procs, func(a, b object.ProcTimeline) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if span > 0 {
+		ret.Utilization = float64(totalBusy) / float64(span*time.Duration(tip.gomaxprocs))
+	}
+
+	for i, slot := range ps.slots {
+		if slot.start+trace.Time(defaultProcSlotDuration) <= from {
+			continue
+		}
+
+		busy := slot.busy
+		// Running Ps haven't reported busy time of the current slot yet
+		if i == len(ps.slots)-1 {
+			for _, p := range ps.procs {
+				if p.state == trace.ProcRunning {
+					busy += now.Sub(max(p.lastStart, slot.start))
+				}
+			}
+		}
+		ret.Series = append(ret.Series, object.ProcUtilizationPoint{
+			Time:        slot.start,
+			Interval:    defaultProcSlotDuration,
+			GOMAXPROCS:  slot.gomaxprocs,
+			Utilization: float64(busy) / float64(defaultProcSlotDuration*time.Duration(slot.gomaxprocs)),
+			Threads:     slot.threads,
+			MaxSyscalls: slot.maxSyscalls,
+			ProcSteals:  slot.steals,
+		})
+	}
+
+	return ret
+}
+
+func (tip *TraceProcess) processProcTransition(ev *trace.Event, st trace.StateTransition) {
+	ps := &tip.procs
+	id := st.Resource.Proc()
+	from, to := st.Proc()
+	now := tip.eventTime(ev)
+
+	p, ok := ps.procs[id]
+	if !ok {
+		p = &procTimeline{id: id, intervals: newRing[object.TimeRange](defaultProcIntervals)}
+		ps.procs[id] = p
+	}
+
+	if from == trace.ProcRunning && p.state == trace.ProcRunning && to != trace.ProcRunning {
+		p.intervals.add(object.TimeRange{Start: p.lastStart, End: now})
+		p.busy += now.Sub(p.lastStart)
+		tip.addProcBusy(p.lastStart, now)
+	}
+	if to == trace.ProcRunning && p.state != trace.ProcRunning {
+		p.lastStart = now
+	}
+	p.state = to
+
+	// ProcSteal is the only transition having no context P of its own
+	if from == trace.ProcRunning && to == trace.ProcIdle && ev.Proc() != id {
+		if slot := tip.procSlot(now); slot != nil {
+			slot.steals++
+		}
+	}
+}
+
+// addProcBusy distributes a P busy interval over utilization slots
+func (tip *TraceProcess) addProcBusy(start, end trace.Time) {
+	slotDuration := trace.Time(defaultProcSlotDuration)
+	for slotStart := start - start%slotDuration; slotStart < end; slotStart += slotDuration {
+		slot := tip.procSlot(slotStart)
+		if slot == nil || slot.start != slotStart {
+			continue
+		}
+		slot.busy += min(end, slotStart+slotDuration).Sub(max(start, slotStart))
+	}
+}
+
+// procSlot returns a slot containing "at", a new slot is created if "at" is after the last one. Nil is returned if
+// the slot has been dropped already
+func (tip *TraceProcess) procSlot(at trace.Time) *procSlot {
+	ps := &tip.procs
+	start := at - at%trace.Time(defaultProcSlotDuration)
+	last := len(ps.slots) - 1
+	if last >= 0 && ps.slots[last].start >= start {
+		idx, found := slices.BinarySearchFunc(ps.slots, start, func(slot procSlot, t trace.Time) int {
+			return cmp.Compare(slot.start, t)
+		})
+		if !found {
+			return nil
+		}
+		return &ps.slots[idx]
+	}
+
+	if len(ps.slots) == defaultProcSlots {
+		ps.slots = append(ps.slots[:0], ps.slots[1:]...)
+	}
+	clear(ps.slotThreads)
+	ps.slots = append(ps.slots, procSlot{start: start, gomaxprocs: tip.gomaxprocs, maxSyscalls: ps.syscalls})
+	return &ps.slots[len(ps.slots)-1]
+}
+
+// seeThread counts the thread the event happened on
+func (tip *TraceProcess) seeThread(ev *trace.Event) {
+	thread := ev.Thread()
+	if thread == trace.NoThread {
+		return
+	}
+
+	slot := tip.procSlot(tip.eventTime(ev))
+	if slot == nil || slot != &tip.procs.slots[len(tip.procs.slots)-1] {
+		return
+	}
+	if _, ok := tip.procs.slotThreads[thread]; !ok {
+		tip.procs.slotThreads[thread] = struct{}{}
+		slot.threads++
+	}
+}
+
+// changeSyscalls tracks the number of goroutines being in syscalls
+func (tip *TraceProcess) changeSyscalls(from, to trace.GoState, now trace.Time) {
+	ps := &tip.procs
+	switch {
+	case to == trace.GoSyscall && from != trace.GoSyscall:
+		ps.syscalls++
+	case from == trace.GoSyscall && to != trace.GoSyscall:
+		ps.syscalls = max(ps.syscalls-1, 0)
+	default:
+		return
+	}
+
+	if slot := tip.procSlot(now); slot != nil {
+		slot.maxSyscalls = max(slot.maxSyscalls, ps.syscalls)
+	}
+}
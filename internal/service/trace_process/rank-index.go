@@ -0,0 +1,139 @@
+package trace_process
+
+import (
+	"cmp"
+	"iter"
+	"math/rand/v2"
+
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// rankIndex keeps goroutines ordered by a statistic value. It is a treap, so updating a goroutine and getting the
+	// first goroutines in either order don't need scanning all goroutines
+	rankIndex struct {
+		root *rankNode
+		len  int
+	}
+
+	// rankKey orders goroutines by value, goroutine ids make keys unique
+	rankKey struct {
+		value int64
+		gID   trace.GoID
+	}
+
+	rankNode struct {
+		key         rankKey
+		stat        *goroutineStat
+		priority    uint64
+		left, right *rankNode
+	}
+)
+
+func (k rankKey) compare(other rankKey) int {
+	if c := cmp.Compare(k.value, other.value); c != 0 {
+		return c
+	}
+	return cmp.Compare(k.gID, other.gID)
+}
+
+func (ri *rankIndex) insert(key rankKey, stat *goroutineStat) {
+	ri.root = insertRankNode(ri.root, &rankNode{key: key, stat: stat, priority: rand.Uint64()})
+	ri.len++
+}
+
+func (ri *rankIndex) delete(key rankKey) {
+	var deleted bool
+	ri.root = deleteRankNode(ri.root, key, &deleted)
+	if deleted {
+		ri.len--
+	}
+}
+
+// ascend iterates over goroutines from the lowest value to the highest one
+func (ri *rankIndex) ascend() iter.Seq[*goroutineStat] {
+	return func(yield func(*goroutineStat) bool) {
+		ascendRankNodes(ri.root, yield)
+	}
+}
+
+// descend iterates over goroutines from the highest value to the lowest one
+func (ri *rankIndex) descend() iter.Seq[*goroutineStat] {
+	return func(yield func(*goroutineStat) bool) {
+		descendRankNodes(ri.root, yield)
+	}
+}
+
+func insertRankNode(n, node *rankNode) *rankNode {
+	if n == nil {
+		return node
+	}
+
+	if node.key.compare(n.key) < 0 {
+		n.left = insertRankNode(n.left, node)
+		if n.left.priority > n.priority {
+			// Rotate right
+			left := n.left
+			n.left, left.right = left.right, n
+			return left
+		}
+		return n
+	}
+
+	n.right = insertRankNode(n.right, node)
+	if n.right.priority > n.priority {
+		// Rotate left
+		right := n.right
+		n.right, right.left = right.left, n
+		return right
+	}
+	return n
+}
+
+func deleteRankNode(n *rankNode, key rankKey, deleted *bool) *rankNode {
+	if n == nil {
+		return nil
+	}
+
+	switch c := key.compare(n.key); {
+	case c < 0:
+		n.left = deleteRankNode(n.left, key, deleted)
+	case c > 0:
+		n.right = deleteRankNode(n.right, key, deleted)
+	default:
+		*deleted = true
+		return mergeRankNodes(n.left, n.right)
+	}
+	return n
+}
+
+// mergeRankNodes merges two treaps where all keys of left are lower than keys of right
+func mergeRankNodes(left, right *rankNode) *rankNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+
+	if left.priority > right.priority {
+		left.right = mergeRankNodes(left.right, right)
+		return left
+	}
+	right.left = mergeRankNodes(left, right.left)
+	return right
+}
+
+func ascendRankNodes(n *rankNode, yield func(*goroutineStat) bool) bool {
+	if n == nil {
+		return true
+	}
+	return ascendRankNodes(n.left, yield) && yield(n.stat) && ascendRankNodes(n.right, yield)
+}
+
+func descendRankNodes(n *rankNode, yield func(*goroutineStat) bool) bool {
+	if n == nil {
+		return true
+	}
+	return descendRankNodes(n.right, yield) && yield(n.stat) && descendRankNodes(n.left, yield)
+}
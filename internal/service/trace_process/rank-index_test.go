@@ -0,0 +1,185 @@
+package trace_process
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestRankIndex(t *testing.T) {
+	var ri rankIndex
+	values := make(map[trace.GoID]int64)
+	for i := range 1000 {
+		gID := trace.GoID(i)
+		values[gID] = rand.Int64N(100)
+		ri.insert(rankKey{value: values[gID], gID: gID}, &goroutineStat{gID: gID})
+	}
+	for gID := range trace.GoID(500) {
+		ri.delete(rankKey{value: values[gID], gID: gID})
+		delete(values, gID)
+	}
+	// Deleting a missing key changes nothing
+	ri.delete(rankKey{value: -1, gID: 1})
+	assert.Equal(t, 500, ri.len)
+
+	var ascending []rankKey
+	for stat := range ri.ascend() {
+		ascending = append(ascending, rankKey{value: values[stat.gID], gID: stat.gID})
+	}
+	assert.Len(t, ascending, 500)
+	assert.True(t, slices.IsSortedFunc(ascending, rankKey.compare))
+
+	var descending []rankKey
+	for stat := range ri.descend() {
+		descending = append(descending, rankKey{value: values[stat.gID], gID: stat.gID})
+		if len(descending) == 10 {
+			break
+		}
+	}
+	slices.Reverse(ascending)
+	assert.Equal(t, ascending[:10], descending)
+}
+
+func TestIdleRanking(t *testing.T) {
+	tp, err := NewTraceProcessor("test")
+	require.NoError(t, err)
+	stats := idleStats(tp, 1000)
+	// Running goroutines aren't idle
+	for _, stat := range stats[:10] {
+		stat.lastRunning = stat.lastStop + 1
+		tp.updateRanks(stat)
+	}
+
+	top := tp.topRanked(rankIdle, 20)
+	require.Len(t, top, 20)
+	assert.True(t, slices.IsSortedFunc(top, func(a, b object.TopGoroutine) int {
+		return cmp.Compare(b.IdleDuration, a.IdleDuration)
+	}))
+	want := slices.Clone(stats[10:])
+	slices.SortFunc(want, func(a, b *goroutineStat) int {
+		return cmp.Or(cmp.Compare(a.lastStop, b.lastStop), cmp.Compare(b.gID, a.gID))
+	})
+	for i := range top {
+		assert.Equal(t, want[i].gID, top[i].ID)
+	}
+	assert.Len(t, tp.topRanked(rankIdle, 2000), 990)
+}
+
+// BenchmarkIdleRanking compares the idle ranking with the sorted list of idling goroutines used before. Every
+// iteration runs and stops a goroutine, the most idling goroutines are requested every 100 iterations
+func BenchmarkIdleRanking(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("ranking/goroutines=%d", n), func(b *testing.B) {
+			tp, err := NewTraceProcessor("bench")
+			require.NoError(b, err)
+			stats := idleStats(tp, n)
+			now := trace.Time(n)
+			for i := 0; b.Loop(); i++ {
+				stat := stats[i%n]
+				now++
+				stat.lastRunning = now
+				tp.updateRanks(stat)
+				now++
+				stat.lastStop = now
+				tp.updateRanks(stat)
+				if i%100 == 0 {
+					tp.topRanked(rankIdle, defaultNumberOfIdlingGoroutines)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("sorted-list/goroutines=%d", n), func(b *testing.B) {
+			tp, err := NewTraceProcessor("bench")
+			require.NoError(b, err)
+			stats := idleStats(tp, n)
+			idling := sortedIdling{living: tp.livingStats, gors: make([]*goroutineStat, 0, defaultNumberOfIdlingGoroutines)}
+			now := trace.Time(n)
+			for i := 0; b.Loop(); i++ {
+				stat := stats[i%n]
+				now++
+				stat.lastRunning = now
+				idling.remove(stat)
+				now++
+				stat.lastStop = now
+				if i%100 == 0 {
+					idling.fill()
+				}
+			}
+		})
+	}
+}
+
+// idleStats adds n living idle goroutines stopped at different times
+func idleStats(tp *TraceProcess, n int) []*goroutineStat {
+	ret := make([]*goroutineStat, n)
+	for i := range ret {
+		stat := &goroutineStat{gID: trace.GoID(i), lastStop: trace.Time(rand.IntN(n) + 1)}
+		tp.livingStats[stat.gID] = stat
+		tp.updateRanks(stat)
+		ret[i] = stat
+	}
+	return ret
+}
+
+// sortedIdling is the list of the most idling goroutines sorted by their stop times which was used before the idle
+// ranking, it is kept for comparison only
+type sortedIdling struct {
+	living map[trace.GoID]*goroutineStat
+	gors   []*goroutineStat
+}
+
+func (si *sortedIdling) fill() {
+	if len(si.gors) == cap(si.gors) {
+		return
+	}
+
+	keys := make([]trace.Time, 0, cap(si.gors))
+	for _, ig := range si.gors {
+		keys = append(keys, ig.lastStop)
+	}
+
+	maxIndex := cap(keys) - 1
+	for _, stat := range si.living {
+		if stat.lastStop == 0 || stat.lastStop < stat.lastRunning ||
+			len(keys) == cap(keys) && stat.lastStop > keys[maxIndex] {
+			continue
+		}
+
+		idx, found := slices.BinarySearch(keys, stat.lastStop)
+		if found || idx == maxIndex && len(keys) == cap(keys) {
+			keys[idx], si.gors[idx] = stat.lastStop, stat
+			continue
+		}
+
+		if len(keys) < cap(keys) {
+			keys = append(keys, stat.lastStop)
+			si.gors = append(si.gors, stat)
+		}
+		if idx == len(keys)-1 {
+			continue
+		}
+
+		copy(keys[idx+1:], keys[idx:])
+		copy(si.gors[idx+1:], si.gors[idx:])
+		keys[idx], si.gors[idx] = stat.lastStop, stat
+	}
+}
+
+func (si *sortedIdling) remove(stat *goroutineStat) {
+	last := len(si.gors) - 1
+	if last == -1 || stat.lastStop > si.gors[last].lastStop {
+		return
+	}
+
+	index := slices.IndexFunc(si.gors, func(gs *goroutineStat) bool { return gs.gID == stat.gID })
+	if index >= 0 {
+		si.gors = slices.Delete(si.gors, index, index+1)
+	}
+}
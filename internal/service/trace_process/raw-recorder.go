@@ -0,0 +1,233 @@
+package trace_process
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+)
+
+const (
+	// defaultRawTracePeriod is how long complete generations of the raw trace are kept
+	defaultRawTracePeriod = time.Minute
+	// rawTraceHeaderSize is a size of the trace header, e.g. "go 1.23 trace\x00\x00\x00"
+	rawTraceHeaderSize = 16
+
+	// Batch header bytes of the trace format, see golang.org/x/exp/trace/internal/tracev2
+	evEventBatch        = 1
+	evExperimentalBatch = 49
+	evEndOfGeneration   = 52
+)
+
+type (
+	// rawRecorder receives raw trace bytes as they are read from the source, splits them into generations and keeps
+	// the latest complete ones, so that they can be written out as a valid trace file
+	rawRecorder struct {
+		mx     sync.Mutex
+		err    error
+		header []byte
+		// pending contains bytes of a batch which hasn't been received completely
+		pending     []byte
+		active      rawGeneration
+		generations []rawGeneration
+		// previous contains the window of the previous stream, it is kept until the current stream has a complete
+		// generation, so the trace right before a disconnect is still available
+		previous *rawWindow
+		// maxGenerations and period limit the number of kept generations, zero means no limit
+		maxGenerations int
+		period         time.Duration
+	}
+
+	rawWindow struct {
+		header      []byte
+		generations []rawGeneration
+	}
+
+	rawGeneration struct {
+		gen         uint64
+		data        []byte
+		completedAt time.Time
+	}
+)
+
+// WithRawTraceWindow sets how many of the latest raw trace generations are kept for export: at most generations of
+// them and only those completed within period. Zero disables a limit, recording is disabled if both are zero
+func WithRawTraceWindow(generations int, period time.Duration) Option {
+	return func(tp *TraceProcess) {
+		if generations >= 0 && period >= 0 {
+			tp.cfg.rawTraceGenerations = generations
+			tp.cfg.rawTracePeriod = period
+		}
+	}
+}
+
+// WriteRawTrace writes the kept window of the raw trace to w as a valid trace file
+func (tip *TraceProcess) WriteRawTrace(w io.Writer) error {
+	if tip.rawTrace == nil {
+		return apiError.ErrNoRawTrace
+	}
+
+	_, err := tip.rawTrace.WriteTo(w)
+	return err
+}
+
+func newRawRecorder(maxGenerations int, period time.Duration) *rawRecorder {
+	return &rawRecorder{maxGenerations: maxGenerations, period: period}
+}
+
+// Write never fails in order not to break reading of the trace. If the stream can't be parsed, the recorder stops
+// recording and keeps the error
+func (rr *rawRecorder) Write(p []byte) (int, error) {
+	rr.mx.Lock()
+	defer rr.mx.Unlock()
+
+	if rr.err != nil {
+		return len(p), nil
+	}
+
+	rr.pending = append(rr.pending, p...)
+	if rr.header == nil {
+		if len(rr.pending) < rawTraceHeaderSize {
+			return len(p), nil
+		}
+		rr.header = bytes.Clone(rr.pending[:rawTraceHeaderSize])
+		rr.pending = rr.pending[rawTraceHeaderSize:]
+	}
+
+	for {
+		gen, size, err := parseBatchHeader(rr.pending)
+		if err != nil {
+			rr.err = err
+			rr.pending = nil
+			return len(p), nil
+		}
+		if size == 0 || size > len(rr.pending) {
+			break
+		}
+
+		batch := rr.pending[:size]
+		if batch[0] == evEndOfGeneration {
+			rr.active.data = append(rr.active.data, batch...)
+			rr.completeActive()
+		} else {
+			if rr.active.gen != 0 && rr.active.gen != gen {
+				rr.completeActive()
+			}
+			rr.active.gen = gen
+			rr.active.data = append(rr.active.data, batch...)
+		}
+		rr.pending = rr.pending[size:]
+	}
+	// Moving the tail to the beginning lets pending not to grow infinitely
+	rr.pending = append(rr.pending[:0:0], rr.pending...)
+
+	return len(p), nil
+}
+
+// WriteTo writes the header and all kept complete generations to w
+func (rr *rawRecorder) WriteTo(w io.Writer) (int64, error) {
+	rr.mx.Lock()
+	header, generations := rr.header, rr.generations
+	if len(generations) == 0 && rr.previous != nil {
+		header, generations = rr.previous.header, rr.previous.generations
+	}
+	rr.mx.Unlock()
+
+	if len(generations) == 0 {
+		return 0, apiError.ErrNoRawTrace
+	}
+
+	n, err := w.Write(header)
+	total := int64(n)
+	if err != nil {
+		return total, fmt.Errorf("failed to write trace header; %w", err)
+	}
+	for _, gen := range generations {
+		n, err = w.Write(gen.data)
+		total += int64(n)
+		if err != nil {
+			return total, fmt.Errorf("failed to write generation %d; %w", gen.gen, err)
+		}
+	}
+
+	return total, nil
+}
+
+// reset is called before a new stream starts because generations of different streams can't be mixed in a single
+// trace. The current window is kept as the previous one until the new stream has a complete generation
+func (rr *rawRecorder) reset() {
+	rr.mx.Lock()
+	defer rr.mx.Unlock()
+
+	if len(rr.generations) > 0 {
+		rr.previous = &rawWindow{header: rr.header, generations: rr.generations}
+	}
+	rr.err, rr.header, rr.pending, rr.active, rr.generations = nil, nil, nil, rawGeneration{}, nil
+}
+
+func (rr *rawRecorder) completeActive() {
+	if len(rr.active.data) == 0 {
+		return
+	}
+
+	rr.active.completedAt = time.Now()
+	// The slice is replaced rather than modified, so WriteTo can use its copy without locking
+	generations := make([]rawGeneration, 0, len(rr.generations)+1)
+	for _, gen := range rr.generations {
+		if rr.period > 0 && rr.active.completedAt.Sub(gen.completedAt) > rr.period {
+			continue
+		}
+		generations = append(generations, gen)
+	}
+	generations = append(generations, rr.active)
+	if rr.maxGenerations > 0 && len(generations) > rr.maxGenerations {
+		generations = generations[len(generations)-rr.maxGenerations:]
+	}
+	rr.generations = generations
+	rr.active = rawGeneration{}
+	rr.previous = nil
+}
+
+// parseBatchHeader returns a generation and a full size of the batch at the beginning of data. Zero size is returned if
+// data doesn't contain the whole batch header yet
+func parseBatchHeader(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, nil
+	}
+
+	offset := 1
+	switch data[0] {
+	case evEndOfGeneration:
+		return 0, 1, nil
+	case evExperimentalBatch:
+		// The experiment id follows the batch type
+		offset++
+	case evEventBatch:
+	default:
+		return 0, 0, fmt.Errorf("unexpected batch type %d", data[0])
+	}
+
+	// The batch header consists of the generation, thread id, timestamp and data length
+	var header [4]uint64
+	for i := range header {
+		if offset >= len(data) {
+			return 0, 0, nil
+		}
+		value, n := binary.Uvarint(data[offset:])
+		if n == 0 {
+			return 0, 0, nil
+		}
+		if n < 0 {
+			return 0, 0, errors.New("invalid batch header")
+		}
+		header[i] = value
+		offset += n
+	}
+
+	return header[0], offset + int(header[3]), nil
+}
@@ -0,0 +1,69 @@
+package trace_process
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	expTrace "golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+)
+
+func TestRawRecorder(t *testing.T) {
+	// The runtime starts a new generation about every second
+	data := collectTrace(t, func() { time.Sleep(1200 * time.Millisecond) })
+	total := countEvents(t, data)
+
+	rr := newRawRecorder(0, time.Minute)
+	// Small chunks make batches split between writes
+	for chunk := range slices.Chunk(data, 7) {
+		n, err := rr.Write(chunk)
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, rr.err)
+	require.GreaterOrEqual(t, len(rr.generations), 2)
+
+	var buf bytes.Buffer
+	_, err := rr.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf.Bytes())
+	assert.Equal(t, total, countEvents(t, buf.Bytes()))
+
+	rr = newRawRecorder(1, 0)
+	_, err = rr.Write(data)
+	require.NoError(t, err)
+	require.Len(t, rr.generations, 1)
+
+	buf.Reset()
+	_, err = rr.WriteTo(&buf)
+	require.NoError(t, err)
+	last := countEvents(t, buf.Bytes())
+	assert.Positive(t, last)
+	assert.Less(t, last, total)
+
+	_, err = newRawRecorder(1, 0).WriteTo(&buf)
+	assert.ErrorIs(t, err, apiError.ErrNoRawTrace)
+}
+
+func countEvents(tb testing.TB, data []byte) int {
+	tb.Helper()
+
+	r, err := expTrace.NewReader(bytes.NewReader(data))
+	require.NoError(tb, err)
+	var ret int
+	for {
+		_, err := r.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			return ret
+		}
+		require.NoError(tb, err)
+		ret++
+	}
+}
@@ -0,0 +1,320 @@
+package trace_process
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultReconnects is a number of the latest reconnects kept in the process state
+	defaultReconnects = 1000
+	// defaultFirstGenerationEvents limits the number of buffered events of the first generation of a new stream
+	defaultFirstGenerationEvents = 1000000
+	// goIDCacheBatch is a number of goroutine ids the runtime hands out to a P at once, see runtime._GoidCacheBatch
+	goIDCacheBatch = 16
+)
+
+type (
+	// streamState contains the connection history of the trace source
+	streamState struct {
+		// streams is a number of streams read from the source
+		streams   int
+		connected bool
+		// disconnectedAt and disconnectReason describe the end of the previous stream
+		disconnectedAt   time.Time
+		disconnectReason string
+		reconnects       ring[object.StreamReconnect]
+		totalReconnects  int
+		// timeOffset is added to event times, it keeps time monotonic when a restarted target's clock is behind the
+		// previous one
+		timeOffset trace.Time
+	}
+)
+
+// State returns the trace source state along with reconnects and gaps between streams
+func (tip *TraceProcess) State() object.ProcessState {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	ret := object.ProcessState{
+		SourcePath:      tip.cfg.sourcePath,
+		Connected:       tip.stream.connected,
+		Streams:         tip.stream.streams,
+		Reconnects:      slices.Collect(tip.stream.reconnects.all()),
+		TotalReconnects: tip.stream.totalReconnects,
+	}
+	if tip.err != nil {
+		ret.Error = tip.err.Error()
+	}
+	if !tip.stream.connected {
+		ret.DisconnectedAt = tip.stream.disconnectedAt
+		ret.DisconnectReason = tip.stream.disconnectReason
+	}
+
+	return ret
+}
+
+func (tip *TraceProcess) eventTime(ev *trace.Event) trace.Time {
+	return ev.Time() + tip.stream.timeOffset
+}
+
+// readStream processes events of a single stream until it ends. Events are read in background and processed in
+// batches, so queries don't wait for every single event. The first generation of every stream but the first one is
+// buffered in order to find out if the target has been restarted before the events are applied
+func (tip *TraceProcess) readStream(ctx context.Context, r *trace.Reader) error {
+	tip.mx.Lock()
+	reconnected := tip.stream.streams > 0
+	tip.stream.streams++
+	tip.stream.connected = true
+	tip.err = nil
+	tip.mx.Unlock()
+	defer tip.publishPending()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan trace.Event, defaultEventBatch)
+	// readErr is sent before events are closed
+	readErr := make(chan error, 1)
+	go readEvents(ctx, r, events, readErr)
+
+	ticker := time.NewTicker(tip.cfg.snapshotInterval)
+	defer ticker.Stop()
+	var firstGeneration []trace.Event
+	var syncs int
+	batch := make([]trace.Event, 0, defaultEventBatch)
+	accept := func(ev trace.Event) {
+		if reconnected {
+			// Every generation begins with a sync event, so the second one ends the first generation
+			if ev.Kind() == trace.EventSync {
+				syncs++
+			}
+			if syncs < 2 && len(firstGeneration) < defaultFirstGenerationEvents {
+				firstGeneration = append(firstGeneration, ev)
+				return
+			}
+			tip.startStream(firstGeneration)
+			firstGeneration, reconnected = nil, false
+		}
+		batch = append(batch, ev)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			tip.publishPending()
+		case ev, ok := <-events:
+			// The batch is filled with events which have been read while the previous batch has been processed
+			open := ok
+			for batch = batch[:0]; ok; {
+				accept(ev)
+				if len(batch) == cap(batch) {
+					break
+				}
+				select {
+				case ev, ok = <-events:
+					open = ok
+				default:
+					ok = false
+				}
+			}
+			tip.processEvents(batch)
+
+			if !open {
+				if reconnected {
+					tip.startStream(firstGeneration)
+				}
+				return <-readErr
+			}
+		}
+	}
+}
+
+// readEvents sends events read from r until an error occurs or ctx is done
+func readEvents(ctx context.Context, r *trace.Reader, events chan<- trace.Event, readErr chan<- error) {
+	defer close(events)
+
+	for {
+		ev, err := r.ReadEvent()
+		if err != nil {
+			readErr <- err
+			return
+		}
+
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			readErr <- ctx.Err()
+			return
+		}
+	}
+}
+
+// disconnect closes durations of goroutines and Ps at the last event since nothing is known about them until the next
+// stream starts
+func (tip *TraceProcess) disconnect(reason error) {
+	tip.mx.Lock()
+	defer tip.mx.Unlock()
+
+	tip.stream.connected = false
+	tip.stream.disconnectedAt = time.Now()
+	tip.stream.disconnectReason = "end of stream"
+	if reason != nil && !errors.Is(reason, io.EOF) {
+		tip.stream.disconnectReason = reason.Error()
+	}
+
+	now := tip.lastEventTime
+	for _, stat := range tip.livingStats {
+		if stat.lastTransition == 0 || stat.state == trace.GoUndetermined {
+			continue
+		}
+
+		if stat.state == trace.GoRunning && stat.gcWorker {
+			tip.addGCCPU(stat.lastRunning, now, 1)
+		}
+		tip.recordTransition(
+			stat, goroutineTransition{time: now, from: stat.state, to: trace.GoUndetermined, reason: disconnectedReason},
+		)
+		tip.changeSyscalls(stat.state, trace.GoUndetermined, now)
+		addRegionsDuration(stat.regions, stat.state, stat.lastTransition, now)
+		stat.leaveState(stat.state, trace.GoUndetermined, now)
+		stat.state = trace.GoUndetermined
+		stat.waitReason = ""
+		stat.lastTransition = now
+		tip.updateRanks(stat)
+	}
+	for _, p := range tip.procs.procs {
+		if p.state == trace.ProcRunning {
+			p.intervals.add(object.TimeRange{Start: p.lastStart, End: now})
+			p.busy += now.Sub(p.lastStart)
+			tip.addProcBusy(p.lastStart, now)
+		}
+		p.state = trace.ProcUndetermined
+	}
+	clear(tip.gc.activeRanges)
+	tip.resetGoroutineCounts(now)
+	tip.publishSnapshot()
+}
+
+// startStream applies the buffered first generation of a new stream. If the stream comes from a restarted target,
+// goroutines of the previous process are retired first because their ids are reused by the new process
+func (tip *TraceProcess) startStream(firstGeneration []trace.Event) {
+	tip.mx.Lock()
+	reconnect := object.StreamReconnect{
+		DisconnectedAt: tip.stream.disconnectedAt,
+		ReconnectedAt:  time.Now(),
+		Reason:         tip.stream.disconnectReason,
+	}
+	reconnect.Gap = reconnect.ReconnectedAt.Sub(reconnect.DisconnectedAt)
+
+	var streamStart trace.Time
+	if len(firstGeneration) > 0 {
+		streamStart = tip.eventTime(&firstGeneration[0])
+		if streamStart < tip.lastEventTime {
+			// The target runs with another clock, the offset places the new stream right after the gap
+			reconnect.Restarted = true
+			tip.stream.timeOffset += tip.lastEventTime - streamStart + trace.Time(reconnect.Gap)
+			streamStart = tip.eventTime(&firstGeneration[0])
+		}
+		reconnect.TraceGap = streamStart.Sub(tip.lastEventTime)
+		reconnect.Restarted = reconnect.Restarted || tip.hasForeignGoroutines(firstGeneration)
+	}
+	if reconnect.Restarted {
+		tip.retireGoroutines()
+	}
+	tip.stream.reconnects.add(reconnect)
+	tip.stream.totalReconnects++
+	tip.mx.Unlock()
+
+	for batch := range slices.Chunk(firstGeneration, defaultEventBatch) {
+		tip.processEvents(batch)
+	}
+
+	if len(firstGeneration) > 0 {
+		tip.mx.Lock()
+		tip.terminateMissing(streamStart)
+		tip.mx.Unlock()
+	}
+}
+
+// hasForeignGoroutines checks if events refer to goroutines which can't exist in the previous target process.
+// Goroutine ids are never reused by a process, so a terminated goroutine showing up again or an unknown goroutine
+// having an id below the ids seen before means that the target has been restarted. Ids are handed out to Ps in
+// batches, so ids cached by Ps are allowed to be a bit lower
+func (tip *TraceProcess) hasForeignGoroutines(events []trace.Event) bool {
+	slack := trace.GoID(goIDCacheBatch * max(tip.gomaxprocs, 1))
+	for i := range events {
+		if events[i].Kind() != trace.EventStateTransition {
+			continue
+		}
+		st := events[i].StateTransition()
+		if st.Resource.Kind != trace.ResourceGoroutine {
+			continue
+		}
+
+		gID := st.Resource.Goroutine()
+		if _, ok := tip.terminatedStats[gID]; ok {
+			return true
+		}
+		_, living := tip.livingStats[gID]
+		_, stale := tip.staleStats[gID]
+		if !living && !stale && gID+slack <= tip.maxGoID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retireGoroutines rolls all goroutines of the previous target process into their groups' totals
+func (tip *TraceProcess) retireGoroutines() {
+	for _, stat := range tip.livingStats {
+		stat.group.terminated.add(stat, tip.lastEventTime)
+		terminateSpawned(stat.spawnEdge)
+		stat.evict()
+	}
+	for _, stale := range tip.staleStats {
+		stale.group.stale.count--
+		stale.group.terminated.count++
+		terminateSpawned(stale.spawnEdge)
+	}
+	for _, stat := range tip.terminatedStats {
+		stat.group.terminated.add(stat, stat.lastTransition)
+		stat.evict()
+	}
+	clear(tip.livingStats)
+	clear(tip.staleStats)
+	clear(tip.terminatedStats)
+	tip.terminatedOrder = nil
+	tip.ranks = [rankKinds]rankIndex{}
+	tip.maxGoID = 0
+
+	// Task ids are reused by the new process as well
+	for _, task := range tip.annotations.activeTasks {
+		tip.annotations.taskType(task.typ).active--
+	}
+	clear(tip.annotations.activeTasks)
+}
+
+// terminateMissing terminates goroutines which haven't shown up in the first generation of a new stream. The first
+// generation contains statuses of all existing goroutines, so the missing ones have exited while disconnected
+func (tip *TraceProcess) terminateMissing(streamStart trace.Time) {
+	for gID, stat := range tip.livingStats {
+		if stat.lastSeen < streamStart {
+			tip.changeGoroutineState(trace.GoUndetermined, trace.GoNotExist, streamStart)
+			tip.handleTerminated(gID, stat.state, streamStart)
+		}
+	}
+	for gID := range tip.staleStats {
+		tip.changeGoroutineState(trace.GoUndetermined, trace.GoNotExist, streamStart)
+		tip.handleTerminated(gID, trace.GoUndetermined, streamStart)
+	}
+}
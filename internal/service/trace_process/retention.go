@@ -0,0 +1,168 @@
+package trace_process
+
+import (
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+const (
+	// defaultMaxTerminatedGoroutines is a maximum number of terminated goroutines kept with their own stats, the
+	// oldest ones are rolled into their groups' totals
+	defaultMaxTerminatedGoroutines = 100000
+	// defaultStaleGoroutineAge is a period after which a living goroutine which hasn't been seen is evicted
+	defaultStaleGoroutineAge = time.Hour
+	// defaultEvictionInterval is an interval of checking living goroutines for staleness
+	defaultEvictionInterval = 10 * time.Second
+	// staleState is a state name of goroutines evicted from livingStats
+	staleState = "Stale"
+)
+
+type (
+	// staleGoroutine is a compact record of a living goroutine which hasn't been seen for a long time. If the goroutine
+	// shows up again, its stat is restored from the record
+	staleGoroutine struct {
+		gID       trace.GoID
+		firstSeen trace.Time
+		created   bool
+		group     *stackGroup
+		invokedBy *goroutineStat
+		spawnEdge *spawnEdge
+	}
+
+	// evictedTotals contains totals of goroutines evicted from livingStats or terminatedStats
+	evictedTotals struct {
+		count            int
+		execDuration     time.Duration
+		runnableDuration time.Duration
+		waitDurations    map[string]time.Duration
+	}
+)
+
+func WithStaleGoroutineAge(age time.Duration) Option {
+	return func(tp *TraceProcess) {
+		if age > 0 {
+			tp.cfg.staleGoroutineAge = age
+		}
+	}
+}
+
+func WithMaxTerminatedGoroutines(count int) Option {
+	return func(tp *TraceProcess) {
+		if count > 0 {
+			tp.cfg.maxTerminatedGoroutines = count
+		}
+	}
+}
+
+// evictStale demotes living goroutines which haven't been seen for the configured stale age. It is done not more
+// often than defaultEvictionInterval or the stale age if it is shorter
+func (tip *TraceProcess) evictStale() {
+	age := tip.cfg.staleGoroutineAge
+	if age <= 0 || tip.lastEventTime.Sub(tip.lastEviction) < min(age, defaultEvictionInterval) {
+		return
+	}
+	tip.lastEviction = tip.lastEventTime
+
+	for gID, stat := range tip.livingStats {
+		if tip.lastEventTime.Sub(stat.lastSeen) < age || stat.state == trace.GoRunning {
+			continue
+		}
+
+		delete(tip.livingStats, gID)
+		tip.removeRanks(stat)
+		stat.group.stale.add(stat, tip.lastEventTime)
+		tip.staleStats[gID] = &staleGoroutine{
+			gID:       gID,
+			firstSeen: stat.firstSeen,
+			created:   stat.created,
+			group:     stat.group,
+			invokedBy: stat.invokedBy,
+			spawnEdge: stat.spawnEdge,
+		}
+		stat.evict()
+	}
+}
+
+// evictTerminated rolls the oldest terminated goroutines into their groups' totals when the number of terminated
+// goroutines exceeds the configured maximum. The evicted stats stay reachable by their children's invokedBy, so they
+// are stripped down
+func (tip *TraceProcess) evictTerminated() {
+	for len(tip.terminatedStats) > tip.cfg.maxTerminatedGoroutines && len(tip.terminatedOrder) > 0 {
+		stat := tip.terminatedOrder[0]
+		tip.terminatedOrder[0] = nil
+		tip.terminatedOrder = tip.terminatedOrder[1:]
+		if tip.terminatedStats[stat.gID] != stat {
+			continue
+		}
+
+		delete(tip.terminatedStats, stat.gID)
+		stat.group.terminated.add(stat, stat.lastTransition)
+		stat.evict()
+	}
+}
+
+// evict marks the stat rolled into its group's totals and drops everything but what is needed to report it as a parent
+// of another goroutine. The parent of the stat is dropped as well, so chains of evicted parents can't grow
+func (gs *goroutineStat) evict() {
+	gs.evicted = true
+	gs.invokedBy = nil
+	gs.waitDurations = nil
+	gs.blockingSites = nil
+	gs.wokenBy = nil
+	gs.blockedAt = nil
+	gs.history.reset()
+	gs.regions = nil
+	gs.spawnEdge = nil
+	gs.spawns = nil
+}
+
+// reviveStale restores a stat of a stale goroutine which has shown up again, nil is returned if the goroutine is not
+// stale. The restored stat starts its durations from scratch because the previous ones are in the group's totals
+func (tip *TraceProcess) reviveStale(gID trace.GoID, now trace.Time) *goroutineStat {
+	stale, ok := tip.staleStats[gID]
+	if !ok {
+		return nil
+	}
+
+	delete(tip.staleStats, gID)
+	stale.group.stale.count--
+	stat := stale.asStat()
+	stat.evicted = false
+	stat.lastSeen = now
+	tip.livingStats[gID] = stat
+
+	return stat
+}
+
+// asStat creates a stat from the record, it is used for reporting stale goroutines along with living ones
+func (sg *staleGoroutine) asStat() *goroutineStat {
+	return &goroutineStat{
+		gID:             sg.gID,
+		firstSeen:       sg.firstSeen,
+		stack:           sg.group.key.stack,
+		transitionStack: sg.group.key.transitionStack,
+		invokedBy:       sg.invokedBy,
+		created:         sg.created,
+		group:           sg.group,
+		spawnEdge:       sg.spawnEdge,
+		evicted:         true,
+	}
+}
+
+func (et *evictedTotals) add(stat *goroutineStat, now trace.Time) {
+	et.count++
+	et.execDuration += stat.execDuration
+	waits, runnable := stat.waitDurationsAt(now)
+	et.runnableDuration += runnable
+	if len(waits) > 0 && et.waitDurations == nil {
+		et.waitDurations = make(map[string]time.Duration)
+	}
+	for reason, d := range waits {
+		et.waitDurations[reason] += d
+	}
+}
+
+func (et *evictedTotals) isEmpty() bool {
+	return et.count == 0 && et.execDuration == 0 && et.runnableDuration == 0 && len(et.waitDurations) == 0
+}
@@ -0,0 +1,76 @@
+package trace_process
+
+import "iter"
+
+// ring is a bounded buffer keeping the last added items, the oldest item is overwritten when the buffer is full
+type ring[T any] struct {
+	items    []T
+	capacity int
+	// next is an index of the oldest item when the buffer is full
+	next int
+}
+
+func newRing[T any](capacity int) ring[T] {
+	return ring[T]{capacity: max(capacity, 1)}
+}
+
+func (r *ring[T]) add(item T) {
+	if len(r.items) < r.capacity {
+		r.items = append(r.items, item)
+		return
+	}
+
+	r.items[r.next] = item
+	r.next = (r.next + 1) % r.capacity
+}
+
+func (r *ring[T]) len() int {
+	return len(r.items)
+}
+
+// last returns a pointer to the newest item, nil is returned if the buffer is empty
+func (r *ring[T]) last() *T {
+	if len(r.items) == 0 {
+		return nil
+	}
+	if len(r.items) < r.capacity {
+		return &r.items[len(r.items)-1]
+	}
+	return &r.items[(r.next+r.capacity-1)%r.capacity]
+}
+
+// all iterates over items from the oldest to the newest
+func (r *ring[T]) all() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i := range r.items {
+			if !yield(r.items[(r.next+i)%len(r.items)]) {
+				return
+			}
+		}
+	}
+}
+
+// reset drops all items and releases the memory they occupy
+func (r *ring[T]) reset() {
+	r.items = nil
+	r.next = 0
+}
+
+// shrink reduces the capacity of the buffer keeping the newest items
+func (r *ring[T]) shrink(capacity int) {
+	capacity = max(capacity, 1)
+	if capacity >= r.capacity {
+		return
+	}
+
+	items := make([]T, 0, min(len(r.items), capacity))
+	skip := len(r.items) - capacity
+	for item := range r.all() {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		items = append(items, item)
+	}
+	r.items, r.capacity, r.next = items, capacity, 0
+}
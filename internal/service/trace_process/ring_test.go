@@ -0,0 +1,25 @@
+package trace_process
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing[int](3)
+	assert.Nil(t, r.last())
+	for i := 1; i <= 5; i++ {
+		r.add(i)
+		assert.Equal(t, i, *r.last())
+	}
+
+	assert.Equal(t, 3, r.len())
+	assert.Equal(t, []int{3, 4, 5}, slices.Collect(r.all()))
+
+	r.shrink(2)
+	assert.Equal(t, []int{4, 5}, slices.Collect(r.all()))
+	r.add(6)
+	assert.Equal(t, []int{5, 6}, slices.Collect(r.all()))
+}
@@ -0,0 +1,50 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// defaultNumberOfLatencyGroups is a maximum number of goroutine groups returned with scheduling latencies
+const defaultNumberOfLatencyGroups = 100
+
+// SchedLatency returns distributions of delays between goroutines becoming runnable and starting running within the
+// window ending at the last event. If window is not positive, all collected data is used
+func (tip *TraceProcess) SchedLatency(window time.Duration) object.SchedLatency {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	global := tip.schedLatency.histogram(tip.cfg.histograms, tip.lastEventTime, window)
+	ret := object.SchedLatency{Window: window, Global: global.convert()}
+	for _, group := range tip.groups {
+		hist := group.schedLatency.histogram(tip.cfg.histograms, tip.lastEventTime, window)
+		if hist.count == 0 {
+			continue
+		}
+		ret.Groups = append(ret.Groups, object.GroupSchedLatency{
+			Stack:           tip.stacks.rendered(group.key.stack),
+			TransitionStack: tip.stacks.rendered(group.key.transitionStack),
+			Histogram:       hist.convert(),
+		})
+	}
+	slices.SortFunc(ret.Groups, func(a, b object.GroupSchedLatency) int {
+		return cmp.Or(cmp.Compare(b.Histogram.P99, a.Histogram.P99), cmp.Compare(b.Histogram.Count, a.Histogram.Count))
+	})
+	if len(ret.Groups) > defaultNumberOfLatencyGroups {
+		ret.Groups = ret.Groups[:defaultNumberOfLatencyGroups]
+	}
+
+	return ret
+}
+
+// addSchedLatency records a delay between the goroutine becoming runnable and starting running
+func (tip *TraceProcess) addSchedLatency(stat *goroutineStat, latency time.Duration, now trace.Time) {
+	tip.schedLatency.add(tip.cfg.histograms, now, latency)
+	stat.schedLatency += latency
+	stat.group.schedLatency.add(tip.cfg.histograms, now, latency)
+}
@@ -0,0 +1,80 @@
+package trace_process
+
+import (
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultEventBatch is a maximum number of events processed under a single lock
+	defaultEventBatch = 1024
+	// defaultSnapshotInterval is a period snapshots are published with while events are coming
+	defaultSnapshotInterval = time.Second
+)
+
+// snapshot contains results of queries which are too expensive to be run by readers under the lock. It is published
+// by the ingestion and never modified afterwards
+type snapshot struct {
+	// lastEventTime is the time of the last event processed before the snapshot has been taken
+	lastEventTime trace.Time
+	idling        []object.TopGoroutine
+}
+
+// WithSnapshotInterval sets a period snapshots are published with while events are coming. Queries served from
+// snapshots, e.g. TopIdlingGoroutines, lag behind the ingestion by up to this period
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(tp *TraceProcess) {
+		if interval > 0 {
+			tp.cfg.snapshotInterval = interval
+		}
+	}
+}
+
+// TopIdlingGoroutines returns defaultNumberOfIdlingGoroutines most idling goroutines as of the latest snapshot
+func (tip *TraceProcess) TopIdlingGoroutines() []object.TopGoroutine {
+	s := tip.snapshot.Load()
+	if s == nil {
+		return nil
+	}
+	return slices.Clone(s.idling)
+}
+
+// processEvents processes the events under a single lock and publishes a snapshot if the previous one is old enough.
+// The events are expected to be read while the previous batch has been processed, so there is a single event in
+// a batch at low event rates and many of them at high rates
+func (tip *TraceProcess) processEvents(events []trace.Event) {
+	tip.mx.Lock()
+	defer tip.mx.Unlock()
+
+	for i := range events {
+		tip.processEvent(&events[i])
+	}
+	tip.dirty = tip.dirty || len(events) > 0
+	if time.Since(tip.publishedAt) >= tip.cfg.snapshotInterval {
+		tip.publishSnapshot()
+	}
+}
+
+// publishPending publishes a snapshot if events have been processed since the previous one
+func (tip *TraceProcess) publishPending() {
+	tip.mx.Lock()
+	defer tip.mx.Unlock()
+
+	if tip.dirty {
+		tip.publishSnapshot()
+	}
+}
+
+// publishSnapshot takes a snapshot, the caller must hold the lock for writing
+func (tip *TraceProcess) publishSnapshot() {
+	tip.snapshot.Store(&snapshot{
+		lastEventTime: tip.lastEventTime,
+		idling:        tip.topRanked(rankIdle, defaultNumberOfIdlingGoroutines),
+	})
+	tip.publishedAt = time.Now()
+	tip.dirty = false
+}
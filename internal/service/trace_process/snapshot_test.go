@@ -0,0 +1,126 @@
+package trace_process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	expTrace "golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestTopIdlingGoroutinesSnapshot(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		for range 3 {
+			go leakingWorker(release)
+		}
+		time.Sleep(10 * time.Millisecond)
+	})
+	close(release)
+
+	tp, err := NewTraceProcessor("test", WithSnapshotInterval(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, tp.TopIdlingGoroutines())
+	// The pending snapshot is published when the stream ends even if the interval hasn't passed
+	readStream(t, tp, data)
+	top := tp.TopIdlingGoroutines()
+	workers := make(map[expTrace.GoID]bool)
+	for _, gor := range top {
+		if strings.Contains(gor.TransitionStack, "leakingWorker") {
+			workers[gor.ID] = true
+		}
+	}
+	assert.Len(t, workers, 3)
+
+	// Goroutines returned from the snapshot may be modified by callers
+	require.NoError(t, tp.FormatStacks(object.StackFormatID, top))
+	for _, gor := range tp.TopIdlingGoroutines() {
+		if workers[gor.ID] {
+			assert.Contains(t, gor.TransitionStack, "leakingWorker")
+		}
+	}
+}
+
+func TestConcurrentQueries(t *testing.T) {
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go fanOutHandler(&wg)
+		}
+		wg.Wait()
+	})
+
+	tp, err := NewTraceProcessor("test", WithSnapshotInterval(time.Millisecond))
+	require.NoError(t, err)
+	stop := startReaders(tp, 4)
+	readStream(t, tp, data)
+	stop()
+
+	groups := tp.GoroutineGroups(true)
+	assert.NotEmpty(t, groups)
+}
+
+func BenchmarkIngestion(b *testing.B) {
+	release := make(chan struct{})
+	data := collectTrace(b, func() {
+		for range 1000 {
+			go leakingWorker(release)
+		}
+		var wg sync.WaitGroup
+		for range 200 {
+			wg.Add(1)
+			go fanOutHandler(&wg)
+		}
+		wg.Wait()
+	})
+	close(release)
+	events := countEvents(b, data)
+
+	for _, readers := range []int{0, 1, 4} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			for b.Loop() {
+				tp, err := NewTraceProcessor("bench")
+				require.NoError(b, err)
+				stop := startReaders(tp, readers)
+				readStream(b, tp, data)
+				stop()
+			}
+			b.ReportMetric(float64(events*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
+
+// startReaders runs goroutines querying the trace process until the returned function is called
+func startReaders(tp *TraceProcess, readers int) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				tp.TopIdlingGoroutines()
+				_, _ = tp.TopGoroutines(object.RankByExec, 10, false, "")
+				tp.GoroutineGroups(true)
+				tp.ContentionSites(10)
+			}
+		}()
+	}
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,177 @@
+package trace_process
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+type (
+	spawnEdgeKey struct {
+		parent, child *stackGroup
+	}
+
+	// spawnEdge counts goroutines of the child group spawned by goroutines of the parent group
+	spawnEdge struct {
+		key        spawnEdgeKey
+		living     int
+		terminated int
+		parents    int
+		maxFanOut  int
+	}
+
+	// spawnCount is a number of children a goroutine has spawned along the edge
+	spawnCount struct {
+		edge  *spawnEdge
+		count int
+	}
+)
+
+// SpawnTree returns creation sites linked by spawning goroutines. Edges are sorted by the number of spawned goroutines
+// in descending order
+func (tip *TraceProcess) SpawnTree() object.SpawnTree {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	edges := make([]*spawnEdge, 0, len(tip.spawnEdges))
+	for _, edge := range tip.spawnEdges {
+		edges = append(edges, edge)
+	}
+	slices.SortFunc(edges, func(a, b *spawnEdge) int {
+		return cmp.Or(
+			cmp.Compare(b.living+b.terminated, a.living+a.terminated),
+			cmp.Compare(a.key.parent.key.transitionStack, b.key.parent.key.transitionStack),
+			cmp.Compare(a.key.child.key.transitionStack, b.key.child.key.transitionStack),
+		)
+	})
+
+	var ret object.SpawnTree
+	ids := make(map[*stackGroup]int)
+	nodeID := func(group *stackGroup) int {
+		id, ok := ids[group]
+		if !ok {
+			id = len(ret.Nodes)
+			ids[group] = id
+			ret.Nodes = append(ret.Nodes, object.SpawnNode{
+				ID:              id,
+				Function:        tip.stacks.topFunction(group.key.transitionStack),
+				Stack:           tip.stacks.rendered(group.key.stack),
+				TransitionStack: tip.stacks.rendered(group.key.transitionStack),
+				Depth:           -1,
+			})
+		}
+		return id
+	}
+
+	children := make(map[int][]int)
+	spawned := make(map[int]bool)
+	for _, edge := range edges {
+		parent, child := nodeID(edge.key.parent), nodeID(edge.key.child)
+		ret.Nodes[child].Living += edge.living
+		ret.Nodes[child].Terminated += edge.terminated
+		ret.Edges = append(ret.Edges, object.SpawnEdge{
+			Parent:     parent,
+			Child:      child,
+			Living:     edge.living,
+			Terminated: edge.terminated,
+			Parents:    edge.parents,
+			MeanFanOut: float64(edge.living+edge.terminated) / float64(max(edge.parents, 1)),
+			MaxFanOut:  edge.maxFanOut,
+		})
+		children[parent] = append(children[parent], child)
+		if parent != child {
+			spawned[child] = true
+		}
+	}
+
+	// Depths are found by BFS from sites which aren't spawned by other sites. Sites within cycles unreachable from
+	// them start new trees
+	var queue []int
+	for id := range ret.Nodes {
+		if !spawned[id] {
+			ret.Nodes[id].Depth = 0
+			queue = append(queue, id)
+		}
+	}
+	for root := 0; ; {
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, child := range children[id] {
+				if ret.Nodes[child].Depth < 0 {
+					ret.Nodes[child].Depth = ret.Nodes[id].Depth + 1
+					queue = append(queue, child)
+				}
+			}
+		}
+		for root < len(ret.Nodes) && ret.Nodes[root].Depth >= 0 {
+			root++
+		}
+		if root == len(ret.Nodes) {
+			break
+		}
+		ret.Nodes[root].Depth = 0
+		queue = append(queue, root)
+	}
+
+	return ret
+}
+
+// WriteSpawnTreeDOT writes the spawn tree in Graphviz DOT format
+func WriteSpawnTreeDOT(w io.Writer, tree object.SpawnTree) error {
+	var sb strings.Builder
+	sb.WriteString("digraph spawn_tree {\n\tnode [shape=box];\n")
+	for _, node := range tree.Nodes {
+		label := fmt.Sprintf("%s\nliving: %d, terminated: %d", node.Function, node.Living, node.Terminated)
+		fmt.Fprintf(&sb, "\tn%d [label=%s];\n", node.ID, dotQuote(label))
+	}
+	for _, edge := range tree.Edges {
+		label := fmt.Sprintf("%d (%d living)\nfan-out: %.1f, max %d",
+			edge.Living+edge.Terminated, edge.Living, edge.MeanFanOut, edge.MaxFanOut)
+		fmt.Fprintf(&sb, "\tn%d -> n%d [label=%s];\n", edge.Parent, edge.Child, dotQuote(label))
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// addSpawn counts the child goroutine spawned by the parent one
+func (tip *TraceProcess) addSpawn(parent, child *goroutineStat) {
+	key := spawnEdgeKey{parent: parent.group, child: child.group}
+	edge, ok := tip.spawnEdges[key]
+	if !ok {
+		edge = &spawnEdge{key: key}
+		tip.spawnEdges[key] = edge
+	}
+	edge.living++
+	child.spawnEdge = edge
+
+	idx := slices.IndexFunc(parent.spawns, func(sc spawnCount) bool { return sc.edge == edge })
+	if idx < 0 {
+		edge.parents++
+		parent.spawns = append(parent.spawns, spawnCount{edge: edge})
+		idx = len(parent.spawns) - 1
+	}
+	parent.spawns[idx].count++
+	edge.maxFanOut = max(edge.maxFanOut, parent.spawns[idx].count)
+}
+
+// terminateSpawned moves a goroutine from living to terminated ones of its spawn edge
+func terminateSpawned(edge *spawnEdge) {
+	if edge != nil {
+		edge.living--
+		edge.terminated++
+	}
+}
+
+// dotQuote quotes s as a DOT string, line breaks are kept as "\n" escapes
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
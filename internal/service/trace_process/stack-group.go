@@ -0,0 +1,123 @@
+package trace_process
+
+import (
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// defaultGroupSampleIDs is a number of goroutine IDs returned as samples of a goroutine group
+const defaultGroupSampleIDs = 5
+
+type (
+	stackGroupKey struct {
+		stack           stackID
+		transitionStack stackID
+	}
+
+	// stackGroup is a set of goroutines having identical stack and transition stack, i.e. running the same code path
+	stackGroup struct {
+		key          stackGroupKey
+		schedLatency windowedHistogram
+		// stale and terminated contain totals of goroutines evicted from livingStats and terminatedStats
+		stale      evictedTotals
+		terminated evictedTotals
+	}
+)
+
+// GoroutineGroups returns living goroutines (and terminated ones if withTerminated is true) aggregated by their stacks.
+// Groups are sorted by the number of goroutines in descending order
+func (tip *TraceProcess) GoroutineGroups(withTerminated bool) []object.GoroutineGroup {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	groups := make(map[*stackGroup]*object.GoroutineGroup)
+	getGroup := func(sg *stackGroup) *object.GoroutineGroup {
+		group, ok := groups[sg]
+		if !ok {
+			group = &object.GoroutineGroup{
+				Stack:           tip.stacks.rendered(sg.key.stack),
+				TransitionStack: tip.stacks.rendered(sg.key.transitionStack),
+				States:          make(map[string]int),
+				WaitDurations:   make(map[string]time.Duration),
+			}
+			groups[sg] = group
+		}
+		return group
+	}
+	addEvicted := func(group *object.GoroutineGroup, totals *evictedTotals, state string) {
+		if totals.count > 0 {
+			group.Count += totals.count
+			group.States[state] += totals.count
+		}
+		group.ExecDuration += totals.execDuration
+		group.RunnableDuration += totals.runnableDuration
+		for reason, d := range totals.waitDurations {
+			group.WaitDurations[reason] += d
+		}
+	}
+	add := func(stat *goroutineStat) {
+		group := getGroup(stat.group)
+		group.Count++
+		group.States[stat.state.String()]++
+		group.ExecDuration += stat.execDuration
+		waits, runnable := stat.waitDurationsAt(tip.lastEventTime)
+		for reason, d := range waits {
+			group.WaitDurations[reason] += d
+		}
+		group.RunnableDuration += runnable
+		if stat.lastRunning < stat.lastStop {
+			group.IdleDuration += tip.lastEventTime.Sub(stat.lastStop)
+		}
+		if len(group.SampleIDs) < defaultGroupSampleIDs {
+			group.SampleIDs = append(group.SampleIDs, stat.gID)
+		}
+	}
+
+	for _, stat := range tip.livingStats {
+		add(stat)
+	}
+	if withTerminated {
+		for _, stat := range tip.terminatedStats {
+			add(stat)
+		}
+	}
+	// Evicted goroutines are represented by their groups' totals only
+	for _, sg := range tip.groups {
+		if !sg.stale.isEmpty() {
+			addEvicted(getGroup(sg), &sg.stale, staleState)
+		}
+		if withTerminated && !sg.terminated.isEmpty() {
+			addEvicted(getGroup(sg), &sg.terminated, trace.GoNotExist.String())
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	ret := make([]object.GoroutineGroup, 0, len(groups))
+	for _, group := range groups {
+		slices.Sort(group.SampleIDs)
+		ret = append(ret, *group)
+	}
+	slices.SortFunc(ret, func(a, b object.GoroutineGroup) int {
+		return b.Count - a.Count
+	})
+
+	return ret
+}
+
+// stackGroup returns the group for the given stacks, the group is created if it doesn't exist yet
+func (tip *TraceProcess) stackGroup(stack, transitionStack stackID) *stackGroup {
+	key := stackGroupKey{stack: stack, transitionStack: transitionStack}
+	group, ok := tip.groups[key]
+	if !ok {
+		group = &stackGroup{key: key}
+		tip.groups[key] = group
+	}
+
+	return group
+}
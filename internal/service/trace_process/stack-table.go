@@ -0,0 +1,212 @@
+package trace_process
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// noStack is the id of the empty stack
+const noStack stackID = 0
+
+type (
+	// stackID identifies a stack in the stack table of a trace process
+	stackID uint32
+
+	// stackTable interns stacks, every distinct stack is kept once no matter how many goroutines and events refer to it
+	stackTable struct {
+		ids    map[string]stackID
+		stacks []internedStack
+		// key is a buffer to build lookup keys without allocations
+		key []byte
+	}
+
+	internedStack struct {
+		frames   []object.StackFrame
+		rendered string
+	}
+)
+
+func newStackTable() stackTable {
+	return stackTable{ids: map[string]stackID{"": noStack}, stacks: []internedStack{{}}}
+}
+
+// Stack returns the interned stack with the given id
+func (tip *TraceProcess) Stack(id int) (object.Stack, error) {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	if id < 0 || id >= len(tip.stacks.stacks) {
+		return object.Stack{}, apiError.ErrStackNotFound
+	}
+	stack := tip.stacks.stacks[id]
+	return object.Stack{ID: id, Frames: stack.frames, Rendered: stack.rendered}, nil
+}
+
+// FormatStacks converts stacks of the goroutines to the given format, the goroutines are expected to have rendered
+// stacks. An empty format keeps stacks rendered
+func (tip *TraceProcess) FormatStacks(format object.StackFormat, gors []object.TopGoroutine) error {
+	if convert, err := convertsStacks(format); !convert {
+		return err
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	for i := range gors {
+		tip.formatTopStacks(format, &gors[i])
+	}
+	return nil
+}
+
+// FormatTimelineStacks converts stacks of the goroutine timeline to the given format
+func (tip *TraceProcess) FormatTimelineStacks(format object.StackFormat, timeline *object.GoroutineTimeline) error {
+	if convert, err := convertsStacks(format); !convert {
+		return err
+	}
+
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	tip.formatTopStacks(format, &timeline.Goroutine)
+	for i := range timeline.Transitions {
+		tr := &timeline.Transitions[i]
+		tr.Stack, tr.StackFrames = tip.stacks.format(format, stackID(tr.StackID))
+	}
+	timeline.BlockingSites = nil
+	if format == object.StackFormatStructured {
+		for _, id := range timeline.BlockingSiteIDs {
+			timeline.BlockingSiteFrames = append(timeline.BlockingSiteFrames, tip.stacks.frames(stackID(id)))
+		}
+	}
+	return nil
+}
+
+// convertsStacks returns true if rendered stacks have to be converted to the format
+func convertsStacks(format object.StackFormat) (bool, error) {
+	switch format {
+	case "", object.StackFormatRendered:
+		return false, nil
+	case object.StackFormatStructured, object.StackFormatID:
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: %q", apiError.ErrUnknownStackFormat, format)
+	}
+}
+
+func (tip *TraceProcess) formatTopStacks(format object.StackFormat, gor *object.TopGoroutine) {
+	gor.StackFormat = format
+	gor.Stack, gor.StackFrames = tip.stacks.format(format, stackID(gor.StackID))
+	gor.TransitionStack, gor.TransitionStackFrames = tip.stacks.format(format, stackID(gor.TransitionStackID))
+	gor.BlockingStack, gor.BlockingStackFrames = tip.stacks.format(format, stackID(gor.BlockingStackID))
+	// Goroutines may come from a snapshot, so the creator is copied rather than modified
+	if gor.InvokedBy != nil {
+		invokedBy := *gor.InvokedBy
+		tip.formatTopStacks(format, &invokedBy)
+		gor.InvokedBy = &invokedBy
+	}
+}
+
+// intern returns the id of the stack, the stack is added to the table if it hasn't been seen before
+func (st *stackTable) intern(stack trace.Stack) stackID {
+	st.key = st.key[:0]
+	for frame := range stack.Frames() {
+		st.key = appendFrameKey(st.key, frame.PC, frame.Func, frame.File, frame.Line)
+	}
+	if id, ok := st.ids[string(st.key)]; ok {
+		return id
+	}
+
+	var frames []object.StackFrame
+	for frame := range stack.Frames() {
+		frames = append(frames, newStackFrame(frame.PC, frame.Func, frame.File, frame.Line))
+	}
+	return st.add(string(st.key), frames)
+}
+
+// internFrames returns the id of the stack consisting of the frames
+func (st *stackTable) internFrames(frames []object.StackFrame) stackID {
+	st.key = st.key[:0]
+	for _, frame := range frames {
+		st.key = appendFrameKey(st.key, frame.PC, frame.Function, frame.File, frame.Line)
+	}
+	if id, ok := st.ids[string(st.key)]; ok {
+		return id
+	}
+	return st.add(string(st.key), frames)
+}
+
+func (st *stackTable) add(key string, frames []object.StackFrame) stackID {
+	id := stackID(len(st.stacks))
+	st.stacks = append(st.stacks, internedStack{frames: frames, rendered: renderStack(frames)})
+	st.ids[key] = id
+	return id
+}
+
+// rendered returns the stack formatted like goroutine dumps do
+func (st *stackTable) rendered(id stackID) string {
+	return st.stacks[id].rendered
+}
+
+func (st *stackTable) frames(id stackID) []object.StackFrame {
+	return st.stacks[id].frames
+}
+
+// format returns the stack as a rendered string or frames depending on the format, both are empty for the id format
+func (st *stackTable) format(format object.StackFormat, id stackID) (string, []object.StackFrame) {
+	switch format {
+	case object.StackFormatStructured:
+		return "", st.stacks[id].frames
+	case object.StackFormatID:
+		return "", nil
+	default:
+		return st.stacks[id].rendered, nil
+	}
+}
+
+// topFunction returns the function of the innermost frame of the stack
+func (st *stackTable) topFunction(id stackID) string {
+	if frames := st.stacks[id].frames; len(frames) > 0 {
+		return frames[0].Function
+	}
+	return "unknown"
+}
+
+// appendFrameKey appends the frame to a lookup key. The function, file and line are a part of the key as well as
+// the PC, so restarted targets built from other sources don't get stale frames
+func appendFrameKey(key []byte, pc uint64, fn, file string, line uint64) []byte {
+	key = binary.LittleEndian.AppendUint64(key, pc)
+	key = binary.LittleEndian.AppendUint64(key, line)
+	key = append(key, fn...)
+	key = append(key, 0)
+	key = append(key, file...)
+	return append(key, 0)
+}
+
+func newStackFrame(pc uint64, fn, file string, line uint64) object.StackFrame {
+	return object.StackFrame{Function: fn, Package: packageName(fn), File: file, Line: line, PC: pc}
+}
+
+// packageName returns the package path of a fully qualified function name, e.g. "net/http" for
+// "net/http.(*Transport).dialConn"
+func packageName(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return ""
+}
+
+// renderStack formats frames like goroutine dumps do, every frame takes two lines
+func renderStack(frames []object.StackFrame) string {
+	var sb strings.Builder
+	for _, frame := range frames {
+		fmt.Fprintf(&sb, "\t%s @ 0x%x\n\t\t%s:%d\n", frame.Function, frame.PC, frame.File, frame.Line)
+	}
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package trace_process
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestStackTable(t *testing.T) {
+	tp, err := NewTraceProcessor("test")
+	require.NoError(t, err)
+	frames := []object.StackFrame{
+		newStackFrame(0x10, "net/http.(*Transport).dialConn", "/go/src/net/http/transport.go", 1800),
+		newStackFrame(0x20, "main.main", "/src/main.go", 5),
+	}
+	id := tp.stacks.internFrames(frames)
+	assert.Equal(t, id, tp.stacks.internFrames(slices.Clone(frames)))
+	assert.NotEqual(t, noStack, id)
+	assert.Equal(t, "net/http", frames[0].Package)
+	assert.Equal(t, "main", frames[1].Package)
+	assert.Equal(t, "net/http.(*Transport).dialConn", tp.stacks.topFunction(id))
+
+	stack, err := tp.Stack(int(id))
+	require.NoError(t, err)
+	assert.Equal(t, frames, stack.Frames)
+	assert.Equal(t, "\tnet/http.(*Transport).dialConn @ 0x10\n\t\t/go/src/net/http/transport.go:1800\n"+
+		"\tmain.main @ 0x20\n\t\t/src/main.go:5\n", stack.Rendered)
+	_, err = tp.Stack(int(id) + 1)
+	assert.ErrorIs(t, err, apiError.ErrStackNotFound)
+
+	gors := []object.TopGoroutine{{
+		Stack: stack.Rendered, StackID: int(id), TransitionStack: stack.Rendered, TransitionStackID: int(id),
+	}}
+	require.NoError(t, tp.FormatStacks(object.StackFormatRendered, gors))
+	assert.Equal(t, stack.Rendered, gors[0].Stack)
+	// Rendered stacks are always in responses unless another format is requested
+	data, err := json.Marshal(object.TopGoroutine{})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"stack":""`)
+	assert.Contains(t, string(data), `"transition-stack":""`)
+	require.NoError(t, tp.FormatStacks(object.StackFormatStructured, gors))
+	assert.Empty(t, gors[0].Stack)
+	assert.Equal(t, frames, gors[0].TransitionStackFrames)
+	assert.Empty(t, gors[0].BlockingStackFrames)
+	data, err = json.Marshal(gors[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"stack"`)
+	assert.NotContains(t, string(data), `"transition-stack"`)
+	assert.Contains(t, string(data), `"transition-stack-frames"`)
+	require.NoError(t, tp.FormatStacks(object.StackFormatID, gors))
+	assert.Empty(t, gors[0].StackFrames)
+	assert.Equal(t, int(id), gors[0].StackID)
+	assert.ErrorIs(t, tp.FormatStacks("xml", gors), apiError.ErrUnknownStackFormat)
+}
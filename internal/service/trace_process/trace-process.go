@@ -5,9 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"slices"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/exp/trace"
@@ -22,39 +21,134 @@ const (
 	defaultEndpointConnectInterval  = 20 * time.Millisecond
 	defaultEndpointConnectionWait   = 60 * time.Second
 	defaultNumberOfIdlingGoroutines = 100
+	// defaultLeakThreshold is a lifetime after which a goroutine is considered as a possible leak
+	defaultLeakThreshold = 1 * time.Minute
 )
 
 type (
 	TraceProcess struct {
-		id            int
-		cfg           config
-		err           error
-		mx            sync.Mutex
+		id  int
+		cfg config
+		err error
+		// mx is locked for writing by the ingestion, queries lock it for reading
+		mx            sync.RWMutex
 		lastEventTime trace.Time
+		// snapshot is the latest published snapshot, dirty is true if events have been processed since it has been
+		// published
+		snapshot    atomic.Pointer[snapshot]
+		publishedAt time.Time
+		dirty       bool
 		// livingStats contains all active (live) goroutines
 		livingStats map[trace.GoID]*goroutineStat
-		// terminatedStats contains all destroyed goroutines
+		// terminatedStats contains destroyed goroutines, the oldest ones are evicted when there are too many of them
 		terminatedStats map[trace.GoID]*goroutineStat
-		// idlingGors contains a short list of idling goroutines sorted by idling time
-		idlingGors []*goroutineStat
-		// TODO more likely some kind of "lastSeen" field would be useful to track a goroutine's lifetime and remove
-		//      from livingStats after some period of time, for example when lastSeen > x seconds
+		// terminatedOrder contains terminated goroutines in order of their termination, it is used for eviction
+		terminatedOrder []*goroutineStat
+		// staleStats contains living goroutines which haven't been seen for a long time
+		staleStats   map[trace.GoID]*staleGoroutine
+		lastEviction trace.Time
+		// stacks contains all stacks goroutines refer to
+		stacks stackTable
+		// groups contains all goroutine groups having identical stacks
+		groups map[stackGroupKey]*stackGroup
+		// schedLatency contains delays between goroutines becoming runnable and starting running
+		schedLatency windowedHistogram
+		gc           gcStat
+		procs        procStat
+		annotations  annotationStat
+		gomaxprocs   int
+		// metrics contains time series of runtime metrics by metric names
+		metrics map[string]*ring[object.MetricPoint]
+		// gorSeries contains numbers of goroutines by states over time
+		gorSeries goroutineSeries
+		// cpu contains CPU samples of the trace
+		cpu cpuProfile
+		// spawnEdges links groups of parent goroutines with groups of goroutines they have spawned
+		spawnEdges map[spawnEdgeKey]*spawnEdge
+		// contention contains sites where goroutines have blocked on mutexes, channels and selects
+		contention map[contentionKey]*contentionSite
+		// wakeEdges links groups of goroutines with groups of goroutines they have woken up
+		wakeEdges map[wakeEdgeKey]*wakeEdge
+		// ranks contains living goroutines ordered by every ranked statistic
+		ranks [rankKinds]rankIndex
+		// rawTrace keeps the latest raw trace generations, it is nil if recording is disabled
+		rawTrace *rawRecorder
+		stream   streamState
+		// maxGoID is the highest goroutine id seen in the target process, it is used to detect restarts
+		maxGoID trace.GoID
 	}
 
 	config struct {
 		sourcePath              string
 		endpointConnectInterval time.Duration
 		endpointConnectionWait  time.Duration
+		leakThreshold           time.Duration
+		histograms              histogramConfig
+		metricPoints            int
+		goroutineSeries         seriesConfig
+		cpuSamples              cpuProfileConfig
+		staleGoroutineAge       time.Duration
+		maxTerminatedGoroutines int
+		goroutineHistory        int
+		blockingSites           int
+		// rawTraceGenerations and rawTracePeriod limit the raw trace window, zero disables a limit. Recording is
+		// disabled if both are zero
+		rawTraceGenerations int
+		rawTracePeriod      time.Duration
+		snapshotInterval    time.Duration
 	}
 
 	Option func(tp *TraceProcess)
 
 	goroutineStat struct {
-		gID             trace.GoID
-		firstSeen       trace.Time
-		stack           string
-		transitionStack string
+		gID       trace.GoID
+		firstSeen trace.Time
+		// lastSeen is the time of the last event related to the goroutine, status events reporting the same state
+		// don't change it
+		lastSeen        trace.Time
+		stack           stackID
+		transitionStack stackID
 		invokedBy       *goroutineStat
+		// created is true if the goroutine creation was observed in the trace
+		created bool
+		group   *stackGroup
+		state   trace.GoState
+		// lastTransition is the time of the last state transition, status events reporting the same state don't change
+		// it, so it is the time the goroutine has entered its current state
+		lastTransition trace.Time
+		// waitReason is a reason of being in the current Waiting or Syscall state
+		waitReason string
+		// waitDurations is time spent in Waiting and Syscall states by wait reasons
+		waitDurations map[string]time.Duration
+		// runnableDuration is time spent in the Runnable state
+		runnableDuration time.Duration
+		// schedLatency is total time between becoming runnable and starting running
+		schedLatency time.Duration
+		// blockCount is a number of times the goroutine has blocked while running
+		blockCount int
+		// blockingSites contains the latest distinct stacks the goroutine has blocked at, the newest is the last one
+		blockingSites []stackID
+		// wokenBy is the wake edge of the goroutine woken up and not running yet
+		wokenBy *wakeEdge
+		// blockedAt is the contention site the goroutine is waiting at now, nil if it doesn't wait for contention
+		blockedAt *contentionSite
+		// history contains the latest state transitions, transitions is a number of all transitions
+		history     ring[goroutineTransition]
+		transitions int
+		// rankValues contains values the goroutine is ranked by, ranked tells in which rankings the goroutine is
+		rankValues [rankKinds]int64
+		ranked     [rankKinds]bool
+		// markAssistDuration is time spent helping GC mark
+		markAssistDuration time.Duration
+		// gcWorker is true for GC background mark workers, their execution time is considered as GC CPU time
+		gcWorker bool
+		// regions contains user regions which the goroutine is in now, the innermost region is the last one
+		regions []*userRegion
+		// spawnEdge is the edge the goroutine has been spawned along, spawns counts children spawned by the goroutine
+		spawnEdge *spawnEdge
+		spawns    []spawnCount
+		// evicted is true if the stat has been rolled into its group's totals
+		evicted bool
 		// goroutine execution time in nanoseconds
 		execDuration time.Duration
 		// lastRunning is the time when goroutine was switched to Running
@@ -80,6 +174,33 @@ func WithEndpointConnectionWait(wait time.Duration) Option {
 	}
 }
 
+func WithLeakThreshold(threshold time.Duration) Option {
+	return func(tp *TraceProcess) {
+		if threshold > 0 {
+			tp.cfg.leakThreshold = threshold
+		}
+	}
+}
+
+// WithHistogramSlots sets how latency histograms are kept: every slot contains samples of slotDuration, the number of
+// slots is limited by slots
+func WithHistogramSlots(slotDuration time.Duration, slots int) Option {
+	return func(tp *TraceProcess) {
+		if slotDuration > 0 && slots > 0 {
+			tp.cfg.histograms = histogramConfig{slotDuration: slotDuration, slots: slots}
+		}
+	}
+}
+
+// WithMetricPoints sets a maximum number of points kept for every runtime metric
+func WithMetricPoints(points int) Option {
+	return func(tp *TraceProcess) {
+		if points > 0 {
+			tp.cfg.metricPoints = points
+		}
+	}
+}
+
 func NewTraceProcessor(sourcePath string, opts ...Option) (*TraceProcess, error) {
 	if sourcePath == "" {
 		return nil, apiError.ErrEmptySourcePath
@@ -87,21 +208,45 @@ func NewTraceProcessor(sourcePath string, opts ...Option) (*TraceProcess, error)
 
 	livingStats := make(map[trace.GoID]*goroutineStat)
 	terminatedStats := make(map[trace.GoID]*goroutineStat)
-	idlingGors := make([]*goroutineStat, 0, defaultNumberOfIdlingGoroutines)
 
 	ret := TraceProcess{
 		cfg: config{
 			sourcePath:              sourcePath,
 			endpointConnectInterval: defaultEndpointConnectInterval,
 			endpointConnectionWait:  defaultEndpointConnectionWait,
+			leakThreshold:           defaultLeakThreshold,
+			histograms:              histogramConfig{slotDuration: defaultHistogramSlotDuration, slots: defaultHistogramSlots},
+			metricPoints:            defaultMetricPoints,
+			goroutineSeries:         seriesConfig{defaultGoroutineSeriesResolution, defaultGoroutineSeriesPoints},
+			cpuSamples:              cpuProfileConfig{defaultCPUSlotDuration, defaultCPUSlots, defaultCPUSamplePeriod, false},
+			staleGoroutineAge:       defaultStaleGoroutineAge,
+			maxTerminatedGoroutines: defaultMaxTerminatedGoroutines,
+			goroutineHistory:        defaultGoroutineHistory,
+			blockingSites:           defaultBlockingSites,
+			rawTracePeriod:          defaultRawTracePeriod,
+			snapshotInterval:        defaultSnapshotInterval,
 		},
 		livingStats:     livingStats,
 		terminatedStats: terminatedStats,
-		idlingGors:      idlingGors,
+		staleStats:      make(map[trace.GoID]*staleGoroutine),
+		groups:          make(map[stackGroupKey]*stackGroup),
+		stacks:          newStackTable(),
+		spawnEdges:      make(map[spawnEdgeKey]*spawnEdge),
+		contention:      make(map[contentionKey]*contentionSite),
+		wakeEdges:       make(map[wakeEdgeKey]*wakeEdge),
+		gc:              newGCStat(),
+		procs:           newProcStat(),
+		annotations:     newAnnotationStat(),
+		gomaxprocs:      1,
+		metrics:         make(map[string]*ring[object.MetricPoint]),
+		stream:          streamState{reconnects: newRing[object.StreamReconnect](defaultReconnects)},
 	}
 	for _, opt := range opts {
 		opt(&ret)
 	}
+	if ret.cfg.rawTraceGenerations > 0 || ret.cfg.rawTracePeriod > 0 {
+		ret.rawTrace = newRawRecorder(ret.cfg.rawTraceGenerations, ret.cfg.rawTracePeriod)
+	}
 
 	return &ret, nil
 }
@@ -110,65 +255,101 @@ func (tip *TraceProcess) IsInProgress(sourcePath string) bool {
 	return tip.cfg.sourcePath == sourcePath
 }
 
+// Run reads and processes trace events in background. If the source is an endpoint, it is reconnected whenever the
+// stream ends, so statistics are accumulated across streams until ctx is done
 func (tip *TraceProcess) Run(ctx context.Context) error {
 	if ctx == nil {
 		return apiError.ErrNilContext
 	}
 
 	go func(c context.Context, tp *TraceProcess) {
-		r, closer, err := helper.CreateTraceReader(c, tp.cfg.sourcePath, tp.cfg.endpointConnectionWait)
-		if err != nil {
-			tp.err = fmt.Errorf("failed to create trace reader; %w", err)
-			return
+		var rawTap io.Writer
+		if tp.rawTrace != nil {
+			rawTap = tp.rawTrace
 		}
-		defer closer.Close()
+		endpoint := helper.IsEndpoint(tp.cfg.sourcePath)
 
 		for {
-			if c.Err() != nil {
-				return
+			if tp.rawTrace != nil {
+				tp.rawTrace.reset()
 			}
-
-			event, err := r.ReadEvent()
-			// TODO consider not break the process
+			r, closer, err := helper.CreateTraceReader(
+				c, tp.cfg.sourcePath, tp.cfg.endpointConnectInterval, tp.cfg.endpointConnectionWait, rawTap,
+			)
 			if err != nil {
-				if errors.Is(err, io.EOF) {
-					return
-				}
-
 				tp.mx.Lock()
-				tp.err = fmt.Errorf("failed to read event; %w", err)
+				tp.err = fmt.Errorf("failed to create trace reader; %w", err)
+				reconnecting := tp.stream.streams > 0
 				tp.mx.Unlock()
+				// Once a stream has been read, the endpoint is waited for until ctx is done
+				if reconnecting && tp.waitReconnect(c) {
+					continue
+				}
 				return
 			}
 
-			tp.processEvent(&event)
+			err = tp.readStream(c, r)
+			closer.Close()
+			if c.Err() != nil {
+				return
+			}
+			if !endpoint {
+				if !errors.Is(err, io.EOF) {
+					tp.mx.Lock()
+					tp.err = fmt.Errorf("failed to read event; %w", err)
+					tp.mx.Unlock()
+				}
+				return
+			}
+
+			tp.disconnect(err)
+			if !tp.waitReconnect(c) {
+				return
+			}
 		}
 	}(ctx, tip)
 
 	return nil
 }
 
-// TopIdlingGoroutines returns defaultNumberOfTopGoroutines most idling goroutines
-func (tip *TraceProcess) TopIdlingGoroutines() []object.TopGoroutine {
-	tip.mx.Lock()
-	defer tip.mx.Unlock()
-
-	tip.fillIdling()
-
-	return tip.idlingAsTop()
+// waitReconnect waits for the connect interval, false is returned if ctx is done
+func (tip *TraceProcess) waitReconnect(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(tip.cfg.endpointConnectInterval):
+		return true
+	}
 }
 
+// processEvent processes a single event, the caller must hold the lock for writing
 func (tip *TraceProcess) processEvent(ev *trace.Event) {
-	tip.mx.Lock()
-	defer tip.mx.Unlock()
-
-	tip.lastEventTime = ev.Time()
+	tip.lastEventTime = tip.eventTime(ev)
+	tip.seeThread(ev)
 	switch ev.Kind() {
 	case trace.EventStateTransition:
 		tip.processTransitionEvent(ev)
+	case trace.EventRangeBegin, trace.EventRangeActive, trace.EventRangeEnd:
+		tip.processGenericEvent(ev)
+		tip.processRangeEvent(ev)
+	case trace.EventMetric:
+		tip.processMetricEvent(ev)
+	case trace.EventTaskBegin, trace.EventTaskEnd:
+		tip.processGenericEvent(ev)
+		tip.processTaskEvent(ev)
+	case trace.EventRegionBegin, trace.EventRegionEnd:
+		tip.processGenericEvent(ev)
+		tip.processRegionEvent(ev)
+	case trace.EventLog:
+		tip.processGenericEvent(ev)
+		tip.processLogEvent(ev)
+	case trace.EventStackSample:
+		tip.processGenericEvent(ev)
+		tip.processStackSample(ev)
 	default:
 		tip.processGenericEvent(ev)
 	}
+	tip.evictStale()
 }
 
 func (tip *TraceProcess) processGenericEvent(ev *trace.Event) {
@@ -177,164 +358,192 @@ func (tip *TraceProcess) processGenericEvent(ev *trace.Event) {
 		return
 	}
 
-	gStat, ok := tip.livingStats[gID]
-	if !ok {
-		gStat = &goroutineStat{gID: gID, firstSeen: ev.Time()}
-		tip.livingStats[gID] = gStat
+	now := tip.eventTime(ev)
+	if gStat, ok := tip.livingStats[gID]; ok {
+		gStat.lastSeen = now
+		return
 	}
+	if stat := tip.reviveStale(gID, now); stat != nil {
+		tip.updateRanks(stat)
+		return
+	}
+
+	gStat := &goroutineStat{gID: gID, firstSeen: now, lastSeen: now, group: tip.stackGroup(noStack, noStack)}
+	tip.livingStats[gID] = gStat
+	tip.updateRanks(gStat)
 }
 
 func (tip *TraceProcess) processTransitionEvent(ev *trace.Event) {
 	st := ev.StateTransition()
-	// TODO analyze if other kind of events should be considered
-	if st.Resource.Kind != trace.ResourceGoroutine {
+	switch st.Resource.Kind {
+	case trace.ResourceGoroutine:
+	case trace.ResourceProc:
+		tip.processProcTransition(ev, st)
+		return
+	default:
 		return
 	}
 
 	gID := st.Resource.Goroutine()
 	from, to := st.Goroutine()
+	now := tip.eventTime(ev)
+	tip.maxGoID = max(tip.maxGoID, gID)
+	tip.changeSyscalls(from, to, now)
+	tip.changeGoroutineState(from, to, now)
+	stack := tip.stacks.intern(st.Stack)
 	if to == trace.GoNotExist {
-		tip.handleTerminated(gID)
+		if gStat, ok := tip.livingStats[gID]; ok {
+			tip.recordTransition(gStat, goroutineTransition{time: now, from: from, to: to, stack: stack, proc: ev.Proc()})
+		}
+		tip.handleTerminated(gID, from, now)
 		return
 	}
 
 	gStat, ok := tip.livingStats[gID]
 	if !ok {
-		var sb strings.Builder
-		for frame := range st.Stack.Frames() {
-			sb.WriteString(fmt.Sprintf("\t%s @ 0x%x\n\t\t%s:%d\n", frame.Func, frame.PC, frame.File, frame.Line))
+		// Status events emitted at generation boundaries don't mean that a stale goroutine has done anything
+		if _, stale := tip.staleStats[gID]; stale && from == to {
+			return
 		}
-
-		var psb strings.Builder
-		for frame := range ev.Stack().Frames() {
-			psb.WriteString(fmt.Sprintf("\t%s @ 0x%x\n\t\t%s:%d\n", frame.Func, frame.PC, frame.File, frame.Line))
+		gStat = tip.reviveStale(gID, now)
+	}
+	if gStat == nil {
+		gStat = &goroutineStat{
+			gID:             gID,
+			firstSeen:       now,
+			stack:           tip.stacks.intern(ev.Stack()),
+			transitionStack: stack,
+			created:         from == trace.GoNotExist,
+			gcWorker:        isGCWorker(st.Stack),
 		}
-
-		gStat = &goroutineStat{gID: gID, firstSeen: ev.Time(), stack: psb.String(), transitionStack: sb.String()}
+		gStat.group = tip.stackGroup(gStat.stack, gStat.transitionStack)
 		invokedByID := ev.Goroutine()
-		if from == trace.GoNotExist && invokedByID != trace.NoGoroutine {
+		if gStat.created && invokedByID != trace.NoGoroutine {
 			parentStat, found := tip.livingStats[invokedByID]
 			if !found {
 				parentStat, found = tip.terminatedStats[invokedByID]
 			}
 			if found {
 				gStat.invokedBy = parentStat
+				tip.addSpawn(parentStat, gStat)
 			}
 		}
 
 		tip.livingStats[gID] = gStat
 	}
 
-	if to == trace.GoRunning {
-		gStat.lastRunning = ev.Time()
-		tip.removeFromIdling(gStat)
-	} else {
-		if gStat.lastStop == 0 {
-			gStat.lastStop = ev.Time()
-		}
+	if from != to || gStat.lastSeen == 0 {
+		gStat.lastSeen = now
 	}
-	if from == trace.GoRunning {
-		gStat.execDuration += ev.Time().Sub(gStat.lastRunning)
-		gStat.lastStop = ev.Time()
+	if from == trace.GoRunnable && to == trace.GoRunning && gStat.lastTransition != 0 {
+		tip.addSchedLatency(gStat, now.Sub(gStat.lastTransition), now)
 	}
-}
-
-// handleTerminated moves the corresponding goroutineStat from livingStats to terminatedStats and removes the goroutine
-// from idlingGors (if exists)
-func (tip *TraceProcess) handleTerminated(gID trace.GoID) {
-	stat, ok := tip.livingStats[gID]
-	if ok {
-		delete(tip.livingStats, gID)
-		tip.terminatedStats[gID] = stat
-		tip.removeFromIdling(stat)
+	if from == trace.GoRunning && to != trace.GoRunning && gStat.gcWorker {
+		tip.addGCCPU(gStat.lastRunning, now, 1)
 	}
-}
-
-func (tip *TraceProcess) fillIdling() {
-	if len(tip.idlingGors) == cap(tip.idlingGors) {
-		return
+	// Status events emitted at generation boundaries report the current state again, durations of the state are
+	// counted when the goroutine really leaves it
+	if from != to {
+		addRegionsDuration(gStat.regions, from, gStat.lastTransition, now)
+		gStat.leaveState(from, to, now)
 	}
-
-	keys := make([]trace.Time, 0, cap(tip.idlingGors))
-	for _, ig := range tip.idlingGors {
-		keys = append(keys, ig.lastStop)
+	if from == trace.GoWaiting && to == trace.GoRunnable && gStat.lastTransition != 0 {
+		tip.addWake(ev.Goroutine(), gStat, now)
 	}
-
-	maxIndex := cap(keys) - 1
-	for _, stat := range tip.livingStats {
-		if stat.lastStop == 0 || stat.lastStop < stat.lastRunning || len(keys) == cap(keys) && stat.lastStop > keys[maxIndex] {
-			continue
-		}
-
-		idx, found := slices.BinarySearch(keys, stat.lastStop)
-		if found || idx == maxIndex && len(keys) == cap(keys) {
-			keys[idx], tip.idlingGors[idx] = stat.lastStop, stat
-			continue
-		}
-
-		if len(keys) < cap(keys) {
-			keys = append(keys, stat.lastStop)
-			tip.idlingGors = append(tip.idlingGors, stat)
+	// Transitions from a state to the same one come from status events which don't have a reason
+	if from != to {
+		gStat.waitReason = waitReason(st, to)
+	}
+	if from == trace.GoRunning && to == trace.GoWaiting {
+		gStat.blockCount++
+		tip.blockAt(gStat, stack)
+	}
+	reason := st.Reason
+	if to == trace.GoWaiting || to == trace.GoSyscall {
+		reason = gStat.waitReason
+		if stack != noStack {
+			tip.addBlockingSite(gStat, stack)
 		}
-		if idx == len(keys)-1 {
-			continue
+	}
+	gStat.state = to
+	if from != to {
+		tr := goroutineTransition{time: now, from: from, to: to, reason: reason, stack: stack, proc: ev.Proc()}
+		tip.recordTransition(gStat, tr)
+		gStat.lastTransition = now
+		if to == trace.GoRunning {
+			gStat.lastRunning = now
 		}
-
-		copy(keys[idx+1:], keys[idx:])
-		copy(tip.idlingGors[idx+1:], tip.idlingGors[idx:])
-		keys[idx], tip.idlingGors[idx] = stat.lastStop, stat
 	}
-}
-
-func (tip *TraceProcess) removeFromIdling(stat *goroutineStat) {
-	lastIdling := len(tip.idlingGors) - 1
-	if lastIdling == -1 || stat.lastStop > tip.idlingGors[lastIdling].lastStop {
-		return
+	if to != trace.GoRunning && gStat.lastStop == 0 {
+		gStat.lastStop = now
 	}
+	tip.updateRanks(gStat)
+}
 
-	index := -1
-	for i, idling := range tip.idlingGors {
-		if idling.gID == stat.gID {
-			index = i
-			break
+// leaveState updates the goroutine's durations when it leaves the "from" state
+func (gs *goroutineStat) leaveState(from, to trace.GoState, now trace.Time) {
+	if from == trace.GoRunning {
+		gs.execDuration += now.Sub(gs.lastRunning)
+		if to != trace.GoRunning {
+			gs.lastStop = now
 		}
 	}
-	if index == -1 {
-		return
+	if from == trace.GoWaiting && to != trace.GoWaiting {
+		gs.unblock(now)
 	}
-	if index == lastIdling {
-		tip.idlingGors = tip.idlingGors[:lastIdling]
-		return
+	if from == trace.GoRunnable && to != trace.GoRunnable {
+		gs.leaveRunnable(to, now)
 	}
-
-	copy(tip.idlingGors[index:], tip.idlingGors[index+1:])
-	tip.idlingGors = tip.idlingGors[:len(tip.idlingGors)-1]
+	gs.addStateDuration(from, now)
 }
 
-func (tip *TraceProcess) idlingAsTop() []object.TopGoroutine {
-	if len(tip.idlingGors) == 0 {
-		return nil
+// handleTerminated moves the corresponding goroutineStat from livingStats to terminatedStats and removes the goroutine
+// from rankings
+func (tip *TraceProcess) handleTerminated(gID trace.GoID, from trace.GoState, now trace.Time) {
+	if stale, ok := tip.staleStats[gID]; ok {
+		delete(tip.staleStats, gID)
+		stale.group.stale.count--
+		stale.group.terminated.count++
+		terminateSpawned(stale.spawnEdge)
+		return
 	}
 
-	ret := make([]object.TopGoroutine, 0, len(tip.idlingGors))
-	for _, stat := range tip.idlingGors {
-		ret = append(ret, tip.convertStatToTop(stat))
+	stat, ok := tip.livingStats[gID]
+	if ok {
+		terminateSpawned(stat.spawnEdge)
+		stat.leaveState(from, trace.GoNotExist, now)
+		delete(tip.livingStats, gID)
+		stat.state = trace.GoNotExist
+		stat.waitReason = ""
+		stat.regions = nil
+		stat.lastTransition = now
+		stat.history.shrink(defaultTerminatedGoroutineHistory)
+		tip.terminatedStats[gID] = stat
+		tip.terminatedOrder = append(tip.terminatedOrder, stat)
+		tip.removeRanks(stat)
+		tip.evictTerminated()
 	}
-
-	return ret
 }
 
 func (tip *TraceProcess) convertStatToTop(stat *goroutineStat) object.TopGoroutine {
 	ret := object.TopGoroutine{
-		ID:              stat.gID,
-		Stack:           stat.stack,
-		TransitionStack: stat.transitionStack,
-		ExecDuration:    stat.execDuration,
-	}
-
-	if stat.lastRunning < stat.lastStop {
-		ret.IdleDuration = tip.lastEventTime.Sub(stat.lastStop)
+		ID:                 stat.gID,
+		Stack:              tip.stacks.rendered(stat.stack),
+		StackID:            int(stat.stack),
+		TransitionStack:    tip.stacks.rendered(stat.transitionStack),
+		TransitionStackID:  int(stat.transitionStack),
+		BlockingStack:      tip.stacks.rendered(stat.blockingStack()),
+		BlockingStackID:    int(stat.blockingStack()),
+		ExecDuration:       stat.execDuration,
+		SchedLatency:       stat.schedLatency,
+		BlockCount:         stat.blockCount,
+		WaitReason:         stat.waitReason,
+		MarkAssistDuration: stat.markAssistDuration,
+		Evicted:            stat.evicted,
 	}
+	ret.WaitDurations, ret.RunnableDuration = stat.waitDurationsAt(tip.lastEventTime)
+	ret.Lifetime = stat.lifetimeAt(tip.lastEventTime)
+	ret.IdleDuration = stat.idleAt(tip.lastEventTime)
 
 	if stat.invokedBy != nil {
 		ib := tip.convertStatToTop(stat.invokedBy)
@@ -343,3 +552,19 @@ func (tip *TraceProcess) convertStatToTop(stat *goroutineStat) object.TopGorouti
 
 	return ret
 }
+
+// idleAt returns time since the goroutine has stopped running, zero is returned for a running goroutine
+func (gs *goroutineStat) idleAt(now trace.Time) time.Duration {
+	if gs.lastRunning < gs.lastStop {
+		return now.Sub(gs.lastStop)
+	}
+	return 0
+}
+
+// lifetimeAt returns time since the goroutine was first seen up to now or the goroutine's termination
+func (gs *goroutineStat) lifetimeAt(now trace.Time) time.Duration {
+	if gs.state == trace.GoNotExist {
+		return gs.lastTransition.Sub(gs.firstSeen)
+	}
+	return now.Sub(gs.firstSeen)
+}
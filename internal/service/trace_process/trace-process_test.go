@@ -0,0 +1,944 @@
+package trace_process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	expTrace "golang.org/x/exp/trace"
+
+	apiError "github.com/maratig/trace_analyzer/api/error"
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+func TestGoroutineLeaks(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		for range 20 {
+			go leakingWorker(release)
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+	close(release)
+
+	tp := processTrace(t, data)
+	leaks := tp.GoroutineLeaks(time.Nanosecond)
+	require.NotEmpty(t, leaks)
+
+	var found bool
+	for _, leak := range leaks {
+		if leak.CreationSeen && strings.Contains(leak.CreationStack, "leakingWorker") {
+			found = true
+			assert.Equal(t, 20, leak.Count)
+			assert.NotEmpty(t, leak.Growth)
+			assert.Equal(t, 20, leak.Growth[len(leak.Growth)-1].Count)
+			assert.Positive(t, leak.OldestAge)
+		}
+	}
+	assert.True(t, found)
+
+	assert.Empty(t, tp.GoroutineLeaks(time.Hour))
+}
+
+func TestGoroutineGroups(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		for range 10 {
+			go leakingWorker(release)
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+	close(release)
+
+	tp := processTrace(t, data)
+	groups := tp.GoroutineGroups(false)
+	require.NotEmpty(t, groups)
+	for i := 1; i < len(groups); i++ {
+		assert.GreaterOrEqual(t, groups[i-1].Count, groups[i].Count)
+	}
+
+	var found bool
+	for _, group := range groups {
+		if strings.Contains(group.TransitionStack, "leakingWorker") {
+			found = true
+			assert.Equal(t, 10, group.Count)
+			assert.Equal(t, 10, group.States[expTrace.GoWaiting.String()])
+			assert.Len(t, group.SampleIDs, defaultGroupSampleIDs)
+		}
+	}
+	assert.True(t, found)
+	assert.GreaterOrEqual(t, len(tp.GoroutineGroups(true)), len(groups))
+}
+
+func TestWaitReasons(t *testing.T) {
+	var mx sync.Mutex
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		mx.Lock()
+		for range 3 {
+			go mutexWaiter(&mx)
+			go leakingWorker(release)
+		}
+		time.Sleep(20 * time.Millisecond)
+		mx.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	})
+	close(release)
+
+	tp := processTrace(t, data)
+	reasons := make(map[string]map[string]time.Duration)
+	for _, group := range tp.GoroutineGroups(true) {
+		switch {
+		case strings.Contains(group.TransitionStack, "mutexWaiter"):
+			reasons["mutexWaiter"] = group.WaitDurations
+		case strings.Contains(group.TransitionStack, "leakingWorker"):
+			reasons["leakingWorker"] = group.WaitDurations
+		}
+	}
+	assert.Positive(t, reasons["mutexWaiter"][waitReasonMutex])
+	assert.Positive(t, reasons["leakingWorker"]["chan receive"])
+}
+
+func TestWaitAcrossGenerations(t *testing.T) {
+	release, leaked := make(chan struct{}), make(chan struct{})
+	defer close(leaked)
+	data := collectTrace(t, func() {
+		go generationWaiter(release)
+		go leakingWorker(leaked)
+		// The runtime starts a new generation about every second, it reports states of all goroutines again
+		time.Sleep(1200 * time.Millisecond)
+		close(release)
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	tp := processTrace(t, data)
+	for _, function := range []string{"generationWaiter", "leakingWorker"} {
+		stat := tp.findStat(findGoroutine(t, tp, function))
+		waits, _ := stat.waitDurationsAt(tp.lastEventTime)
+		assert.GreaterOrEqual(t, waits[waitReasonChanReceive], time.Second, function)
+		assert.LessOrEqual(t, waits[waitReasonChanReceive], stat.lifetimeAt(tp.lastEventTime), function)
+	}
+	// The leaked goroutine is waiting since it has blocked rather than since the last status event
+	stat := tp.findStat(findGoroutine(t, tp, "leakingWorker"))
+	assert.Equal(t, expTrace.GoWaiting, stat.state)
+	assert.GreaterOrEqual(t, tp.lastEventTime.Sub(stat.lastTransition), time.Second)
+}
+
+func generationWaiter(release chan struct{}) {
+	<-release
+}
+
+func TestContentionSites(t *testing.T) {
+	var mx sync.Mutex
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		mx.Lock()
+		for range 3 {
+			go mutexWaiter(&mx)
+			go leakingWorker(release)
+		}
+		time.Sleep(20 * time.Millisecond)
+		mx.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	})
+	close(release)
+
+	sites := make(map[string]object.ContentionSite)
+	for _, site := range processTrace(t, data).ContentionSites(-1) {
+		switch {
+		case strings.Contains(site.Stack, "mutexWaiter"):
+			sites["mutexWaiter"] = site
+		case strings.Contains(site.Stack, "leakingWorker"):
+			sites["leakingWorker"] = site
+		}
+	}
+	mutex := sites["mutexWaiter"]
+	assert.Equal(t, waitReasonMutex, mutex.Reason)
+	assert.GreaterOrEqual(t, mutex.Waiters, int64(3))
+	assert.GreaterOrEqual(t, mutex.MaxWait, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, mutex.TotalWait, mutex.MaxWait)
+	assert.Zero(t, mutex.Blocked)
+	// Workers are still blocked when the trace stops, their waits are in progress
+	worker := sites["leakingWorker"]
+	assert.Equal(t, waitReasonChanReceive, worker.Reason)
+	assert.Equal(t, 3, worker.Blocked)
+	assert.GreaterOrEqual(t, worker.MaxWait, 20*time.Millisecond)
+}
+
+func TestContentionAcrossGenerations(t *testing.T) {
+	var mx sync.Mutex
+	release := make(chan struct{})
+	defer close(release)
+	data := collectTrace(t, func() {
+		mx.Lock()
+		go mutexWaiter(&mx)
+		go leakingWorker(release)
+		// Waits span generation boundaries where the runtime reports states of all goroutines again
+		time.Sleep(1200 * time.Millisecond)
+		mx.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	var found int
+	for _, site := range processTrace(t, data).ContentionSites(-1) {
+		if strings.Contains(site.Stack, "mutexWaiter") || strings.Contains(site.Stack, "leakingWorker") {
+			found++
+			assert.GreaterOrEqual(t, site.MaxWait, time.Second, site.Stack)
+		}
+	}
+	assert.Equal(t, 2, found)
+}
+
+func mutexWaiter(mx *sync.Mutex) {
+	mx.Lock()
+	mx.Unlock()
+}
+
+func TestSchedLatency(t *testing.T) {
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Millisecond)
+			}()
+		}
+		wg.Wait()
+	})
+
+	tp := processTrace(t, data)
+	latency := tp.SchedLatency(0)
+	assert.Positive(t, latency.Global.Count)
+	assert.LessOrEqual(t, latency.Global.P50, latency.Global.P99)
+	assert.LessOrEqual(t, latency.Global.P99, latency.Global.Max)
+	require.NotEmpty(t, latency.Groups)
+	var groupsCount int64
+	for _, group := range latency.Groups {
+		groupsCount += group.Histogram.Count
+	}
+	assert.Equal(t, latency.Global.Count, groupsCount)
+}
+
+func TestSchedLatencyAcrossGenerations(t *testing.T) {
+	// Two Ps run the spinners one by one, so the last ones stay runnable for longer than a generation. A single P
+	// would keep the tracer from starting a new generation
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range 600 {
+			wg.Add(1)
+			go queuedSpinner(&wg)
+		}
+		wg.Wait()
+	})
+
+	var spinners *object.GroupSchedLatency
+	latency := processTrace(t, data).SchedLatency(0)
+	for i := range latency.Groups {
+		if strings.Contains(latency.Groups[i].TransitionStack, "queuedSpinner") {
+			spinners = &latency.Groups[i]
+		}
+	}
+	require.NotNil(t, spinners)
+	// Generations are about a second long, the latency is measured from becoming runnable rather than from the last
+	// status event
+	assert.GreaterOrEqual(t, spinners.Histogram.Max, 2*time.Second)
+}
+
+func queuedSpinner(wg *sync.WaitGroup) {
+	spin(8 * time.Millisecond)
+	wg.Done()
+}
+
+func TestGCReport(t *testing.T) {
+	data := collectTrace(t, func() {
+		for range 3 {
+			runtime.GC()
+		}
+	})
+
+	tp := processTrace(t, data)
+	report := tp.GCReport(0)
+	require.GreaterOrEqual(t, len(report.Cycles), 3)
+	assert.Positive(t, report.Pauses.Count)
+	assert.Contains(t, report.PausesByReason, "GC mark termination")
+	assert.NotEmpty(t, report.CPUFraction)
+	var pauses int
+	for _, cycle := range report.Cycles {
+		pauses += len(cycle.Pauses)
+	}
+	assert.Positive(t, pauses)
+	for _, fraction := range report.CPUFraction {
+		assert.LessOrEqual(t, fraction.Fraction, 1.0)
+	}
+
+	// Nothing happens within an empty window after the last event
+	tp.lastEventTime += expTrace.Time(time.Hour)
+	report = tp.GCReport(time.Minute)
+	assert.Empty(t, report.Cycles)
+	assert.Zero(t, report.SweepDuration)
+	assert.Zero(t, report.BytesSwept)
+}
+
+func TestGCCPUSlots(t *testing.T) {
+	tp, err := NewTraceProcessor("test")
+	require.NoError(t, err)
+	tp.gomaxprocs = 2
+
+	// A long GC worker interval is spread over the slots it overlaps
+	tp.addGCCPU(expTrace.Time(500*time.Millisecond), expTrace.Time(2500*time.Millisecond), 1)
+	tp.addGCCPU(expTrace.Time(2500*time.Millisecond), expTrace.Time(2600*time.Millisecond), 2)
+	report := tp.GCReport(0)
+	require.Len(t, report.CPUFraction, 3)
+	assert.InDelta(t, 0.25, report.CPUFraction[0].Fraction, 1e-9)
+	assert.InDelta(t, 0.5, report.CPUFraction[1].Fraction, 1e-9)
+	assert.InDelta(t, 0.35, report.CPUFraction[2].Fraction, 1e-9)
+}
+
+func TestMetrics(t *testing.T) {
+	data := collectTrace(t, func() {
+		runtime.GC()
+	})
+
+	tp := processTrace(t, data)
+	metrics := tp.Metrics(nil, 0)
+	require.NotEmpty(t, metrics)
+	names := make([]string, 0, len(metrics))
+	for _, series := range metrics {
+		names = append(names, series.Name)
+		assert.NotEmpty(t, series.Points)
+	}
+	assert.Contains(t, names, metricGOMAXPROCSName)
+	assert.Contains(t, names, "/gc/heap/goal:bytes")
+
+	metrics = tp.Metrics([]string{metricGOMAXPROCSName}, 0)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, uint64(runtime.GOMAXPROCS(0)), metrics[0].Points[len(metrics[0].Points)-1].Value)
+}
+
+func TestProcReport(t *testing.T) {
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range runtime.GOMAXPROCS(0) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				spin(20 * time.Millisecond)
+			}()
+		}
+		wg.Wait()
+	})
+
+	tp := processTrace(t, data)
+	report := tp.ProcReport(0)
+	assert.Equal(t, runtime.GOMAXPROCS(0), report.GOMAXPROCS)
+	require.NotEmpty(t, report.Procs)
+	assert.Positive(t, report.Utilization)
+	assert.LessOrEqual(t, report.Utilization, 1.0)
+	require.NotEmpty(t, report.Series)
+	assert.Positive(t, report.Series[0].Threads)
+	for _, p := range report.Procs {
+		assert.LessOrEqual(t, p.Utilization, 1.0)
+	}
+}
+
+// spin keeps a goroutine running for the given duration
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func TestUserAnnotations(t *testing.T) {
+	data := collectTrace(t, func() {
+		for i := range 5 {
+			ctx, task := trace.NewTask(context.Background(), "request")
+			trace.WithRegion(ctx, "handle", func() {
+				trace.Logf(ctx, "handler", "request %d", i)
+				time.Sleep(time.Millisecond)
+				spin(time.Millisecond)
+			})
+			task.End()
+		}
+	})
+
+	tp := processTrace(t, data)
+	tasks := tp.Tasks(0)
+	var request *object.TaskStat
+	for i := range tasks {
+		if tasks[i].Type == "request" {
+			request = &tasks[i]
+		}
+	}
+	require.NotNil(t, request)
+	assert.Equal(t, int64(5), request.Completed)
+	assert.Zero(t, request.Active)
+	assert.GreaterOrEqual(t, request.Latency.P50, 2*time.Millisecond)
+	require.Len(t, request.Regions, 1)
+	region := request.Regions[0]
+	assert.Equal(t, "handle", region.Type)
+	assert.Equal(t, int64(5), region.Count)
+	assert.GreaterOrEqual(t, region.WaitingDuration, 5*time.Millisecond)
+	assert.GreaterOrEqual(t, region.RunningDuration, 5*time.Millisecond)
+	assert.LessOrEqual(t, region.RunningDuration+region.WaitingDuration+region.RunnableDuration, region.Duration)
+
+	logs := tp.Logs("handler", "request 3", 0)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "request", logs[0].TaskType)
+	assert.Len(t, tp.Logs("handler", "", 2), 2)
+	assert.Empty(t, tp.Logs("unknown", "", 0))
+}
+
+func TestTerminatedEviction(t *testing.T) {
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go spawner(&wg)
+		}
+		wg.Wait()
+	})
+
+	tp := processTrace(t, data, WithMaxTerminatedGoroutines(5))
+	assert.LessOrEqual(t, len(tp.terminatedStats), 5)
+
+	var spawners, children int
+	for _, group := range tp.GoroutineGroups(true) {
+		switch {
+		case strings.Contains(group.TransitionStack, "spawner.func1"):
+			children += group.Count
+		case strings.Contains(group.TransitionStack, "spawner"):
+			spawners += group.Count
+		}
+	}
+	assert.Equal(t, 50, spawners)
+	assert.Equal(t, 50, children)
+
+	// Evicted parents are still reachable by their children, but only with what is needed to report them
+	for _, stat := range tp.terminatedStats {
+		if stat.invokedBy != nil && stat.invokedBy.evicted {
+			assert.Contains(t, tp.convertStatToTop(stat).InvokedBy.TransitionStack, "spawner")
+			assert.Nil(t, stat.invokedBy.invokedBy)
+			assert.Zero(t, stat.invokedBy.history.len())
+			assert.Nil(t, stat.invokedBy.spawns)
+		}
+	}
+}
+
+func TestStaleEviction(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		for range 10 {
+			go leakingWorker(release)
+		}
+		time.Sleep(50 * time.Millisecond)
+	})
+	close(release)
+
+	tp := processTrace(t, data, WithStaleGoroutineAge(10*time.Millisecond))
+	require.NotEmpty(t, tp.staleStats)
+
+	var stale int
+	for _, group := range tp.GoroutineGroups(false) {
+		if strings.Contains(group.TransitionStack, "leakingWorker") {
+			assert.Equal(t, 10, group.Count)
+			stale = group.States[staleState]
+		}
+	}
+	assert.Equal(t, 10, stale)
+
+	var leaked int
+	for _, leak := range tp.GoroutineLeaks(time.Nanosecond) {
+		if strings.Contains(leak.CreationStack, "leakingWorker") {
+			leaked = leak.Count
+			assert.True(t, leak.Oldest.Evicted)
+		}
+	}
+	assert.Equal(t, 10, leaked)
+}
+
+func TestStaleEvictionAcrossGenerations(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	data := collectTrace(t, func() {
+		for range 10 {
+			go leakingWorker(release)
+		}
+		// The runtime reports states of all goroutines again at every generation boundary, about once a second
+		time.Sleep(3500 * time.Millisecond)
+	})
+
+	tp := processTrace(t, data, WithStaleGoroutineAge(1500*time.Millisecond))
+	var stale int
+	for _, group := range tp.GoroutineGroups(false) {
+		if strings.Contains(group.TransitionStack, "leakingWorker") {
+			stale = group.States[staleState]
+		}
+	}
+	assert.Equal(t, 10, stale)
+}
+
+func TestReconnect(t *testing.T) {
+	parked, released := make(chan struct{}), make(chan struct{})
+	defer close(parked)
+	first := collectTrace(t, func() {
+		go leakingWorker(parked)
+		go leakingWorker(released)
+		time.Sleep(10 * time.Millisecond)
+	})
+	close(released)
+	// Goroutines created while disconnected move goroutine ids far ahead
+	var wg sync.WaitGroup
+	for range 1000 {
+		wg.Add(1)
+		go wg.Done()
+	}
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+	second := collectTrace(t, func() { time.Sleep(10 * time.Millisecond) })
+
+	tp, err := NewTraceProcessor("test")
+	require.NoError(t, err)
+	readStream(t, tp, first)
+	tp.disconnect(io.EOF)
+	readStream(t, tp, second)
+
+	state := tp.State()
+	assert.Equal(t, 2, state.Streams)
+	require.Len(t, state.Reconnects, 1)
+	assert.False(t, state.Reconnects[0].Restarted)
+	assert.Equal(t, "end of stream", state.Reconnects[0].Reason)
+	assert.Positive(t, state.Reconnects[0].TraceGap)
+
+	// The parked goroutine keeps its identity, the released one has exited while disconnected
+	var living, terminated int
+	for _, stat := range tp.livingStats {
+		if strings.Contains(tp.stacks.rendered(stat.transitionStack), "leakingWorker") {
+			living++
+			assert.True(t, stat.created)
+			assert.Equal(t, expTrace.GoWaiting, stat.state)
+		}
+	}
+	for _, stat := range tp.terminatedStats {
+		if strings.Contains(tp.stacks.rendered(stat.transitionStack), "leakingWorker") {
+			terminated++
+		}
+	}
+	assert.Equal(t, 1, living)
+	assert.Equal(t, 1, terminated)
+
+	// The clock going backwards means another process
+	lastEventTime := tp.lastEventTime
+	tp.disconnect(io.EOF)
+	readStream(t, tp, first)
+	state = tp.State()
+	require.Len(t, state.Reconnects, 2)
+	assert.True(t, state.Reconnects[1].Restarted)
+	assert.Greater(t, tp.lastEventTime, lastEventTime)
+	var workers int
+	for _, group := range tp.GoroutineGroups(true) {
+		if strings.Contains(group.TransitionStack, "leakingWorker") {
+			workers += group.Count
+		}
+	}
+	// Goroutines of the previous process are kept in their groups' totals
+	assert.Equal(t, 4, workers)
+
+	// Goroutine ids which can't belong to the previous process mean another process as well
+	tp, err = NewTraceProcessor("test")
+	require.NoError(t, err)
+	readStream(t, tp, second)
+	tp.disconnect(io.EOF)
+	tp.stream.timeOffset = tp.lastEventTime
+	readStream(t, tp, first)
+	state = tp.State()
+	require.Len(t, state.Reconnects, 1)
+	assert.True(t, state.Reconnects[0].Restarted)
+}
+
+func TestTopGoroutines(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	data := collectTrace(t, func() {
+		for i := range 3 {
+			go func() {
+				spin(time.Duration(i+1) * 5 * time.Millisecond)
+				<-release
+			}()
+		}
+		ping := make(chan struct{})
+		go pingReceiver(ping, release)
+		for range 20 {
+			ping <- struct{}{}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+	})
+	tp := processTrace(t, data)
+
+	top, err := tp.TopGoroutines(object.RankByExec, 3, false, "")
+	require.NoError(t, err)
+	require.Len(t, top, 3)
+	assert.GreaterOrEqual(t, top[0].ExecDuration, 10*time.Millisecond)
+	assert.IsNonIncreasing(t, execDurations(top))
+
+	top, err = tp.TopGoroutines(object.RankByExec, 0, true, "")
+	require.NoError(t, err)
+	assert.Len(t, top, len(tp.livingStats))
+	assert.IsNonDecreasing(t, execDurations(top))
+
+	// Other goroutines of the test binary might block more often
+	top, err = tp.TopGoroutines(object.RankByBlocks, 1, false, "stack ~ pingReceiver")
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Contains(t, top[0].TransitionStack, "pingReceiver")
+	assert.GreaterOrEqual(t, top[0].BlockCount, 20)
+
+	for _, by := range []object.RankBy{object.RankByIdle, object.RankByLifetime, object.RankBySchedLatency} {
+		top, err = tp.TopGoroutines(by, 10, false, "")
+		require.NoError(t, err)
+		assert.NotEmpty(t, top)
+	}
+	top, err = tp.TopGoroutines(object.RankByLifetime, 0, false, "")
+	require.NoError(t, err)
+	lifetimes := make([]time.Duration, 0, len(top))
+	for _, g := range top {
+		lifetimes = append(lifetimes, g.Lifetime)
+	}
+	assert.IsNonIncreasing(t, lifetimes)
+
+	top, err = tp.TopGoroutines(object.RankByExec, 0, false, "stack ~ pingReceiver")
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Contains(t, top[0].TransitionStack, "pingReceiver")
+
+	_, err = tp.TopGoroutines("unknown", 0, false, "")
+	assert.ErrorIs(t, err, apiError.ErrUnknownRanking)
+}
+
+func TestGoroutineTimeline(t *testing.T) {
+	data := collectTrace(t, func() {
+		done := make(chan struct{})
+		go timelineWorker(done)
+		<-done
+		time.Sleep(time.Millisecond)
+	})
+
+	tp := processTrace(t, data)
+	gID := findGoroutine(t, tp, "timelineWorker")
+	timeline, err := tp.GoroutineTimeline(gID)
+	require.NoError(t, err)
+	assert.True(t, timeline.Created)
+	assert.Equal(t, "NotExist", timeline.State)
+	assert.Zero(t, timeline.DroppedTransitions)
+	require.NotEmpty(t, timeline.Transitions)
+	assert.Equal(t, "NotExist", timeline.Transitions[0].From)
+	assert.Equal(t, "NotExist", timeline.Transitions[len(timeline.Transitions)-1].To)
+
+	var slept bool
+	for _, tr := range timeline.Transitions {
+		assert.NotEqual(t, tr.From, tr.To)
+		if tr.To == "Waiting" && tr.Reason == "sleep" {
+			slept = true
+			assert.Contains(t, tr.Stack, "time.Sleep")
+		}
+	}
+	assert.True(t, slept)
+	assert.LessOrEqual(t, tp.terminatedStats[gID].history.capacity, defaultTerminatedGoroutineHistory)
+	require.GreaterOrEqual(t, len(timeline.RunSlices), 2)
+	for _, slice := range timeline.RunSlices {
+		assert.False(t, slice.Ongoing)
+		assert.Equal(t, slice.End.Sub(slice.Start), slice.Duration)
+	}
+
+	tp = processTrace(t, data, WithGoroutineHistory(2))
+	timeline, err = tp.GoroutineTimeline(findGoroutine(t, tp, "timelineWorker"))
+	require.NoError(t, err)
+	assert.Len(t, timeline.Transitions, 2)
+	assert.Positive(t, timeline.DroppedTransitions)
+
+	_, err = tp.GoroutineTimeline(1 << 40)
+	assert.ErrorIs(t, err, apiError.ErrGoroutineNotFound)
+}
+
+func TestBlockingSites(t *testing.T) {
+	first, second, release := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	data := collectTrace(t, func() {
+		go movingWorker(first, second, release)
+		for _, ch := range []chan struct{}{first, second, first} {
+			time.Sleep(time.Millisecond)
+			ch <- struct{}{}
+		}
+		time.Sleep(time.Millisecond)
+	})
+	close(release)
+
+	tp := processTrace(t, data)
+	gID := findGoroutine(t, tp, "movingWorker")
+	timeline, err := tp.GoroutineTimeline(gID)
+	require.NoError(t, err)
+	assert.Contains(t, timeline.Goroutine.TransitionStack, "movingWorker")
+	assert.Contains(t, timeline.Goroutine.BlockingStack, "waitRelease")
+	// The site of the first channel is visited twice but kept once
+	require.Len(t, timeline.BlockingSites, 3)
+	assert.Contains(t, timeline.BlockingSites[0], "waitSecond")
+	assert.Contains(t, timeline.BlockingSites[1], "waitFirst")
+	assert.Contains(t, timeline.BlockingSites[2], "waitRelease")
+
+	gors, err := tp.Goroutines("blocking ~ waitRelease", 0)
+	require.NoError(t, err)
+	require.Len(t, gors, 1)
+	assert.Equal(t, gID, gors[0].ID)
+
+	tp = processTrace(t, data, WithBlockingSites(1))
+	timeline, err = tp.GoroutineTimeline(gID)
+	require.NoError(t, err)
+	require.Len(t, timeline.BlockingSites, 1)
+	assert.Equal(t, timeline.Goroutine.BlockingStack, timeline.BlockingSites[0])
+}
+
+//go:noinline
+func movingWorker(first, second, release chan struct{}) {
+	for i := range 2 {
+		waitFirst(first)
+		if i == 0 {
+			waitSecond(second)
+		}
+	}
+	waitRelease(release)
+}
+
+//go:noinline
+func waitFirst(ch chan struct{}) {
+	<-ch
+}
+
+//go:noinline
+func waitSecond(ch chan struct{}) {
+	<-ch
+}
+
+//go:noinline
+func waitRelease(ch chan struct{}) {
+	<-ch
+}
+
+func TestSpawnTree(t *testing.T) {
+	data := collectTrace(t, func() {
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go fanOutHandler(&wg)
+		}
+		wg.Wait()
+	})
+
+	tree := processTrace(t, data).SpawnTree()
+	var edge *object.SpawnEdge
+	for i := range tree.Edges {
+		if strings.HasSuffix(tree.Nodes[tree.Edges[i].Child].Function, ".fanOutChild") {
+			edge = &tree.Edges[i]
+		}
+	}
+	require.NotNil(t, edge)
+	assert.Contains(t, tree.Nodes[edge.Parent].Function, "fanOutHandler")
+	assert.Equal(t, 20, edge.Terminated)
+	assert.Zero(t, edge.Living)
+	assert.Equal(t, 4, edge.Parents)
+	assert.InDelta(t, 5, edge.MeanFanOut, 0.001)
+	assert.Equal(t, 5, edge.MaxFanOut)
+	assert.Equal(t, tree.Nodes[edge.Parent].Depth+1, tree.Nodes[edge.Child].Depth)
+	assert.Positive(t, tree.Nodes[edge.Parent].Depth)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSpawnTreeDOT(&buf, tree))
+	assert.True(t, strings.HasPrefix(buf.String(), "digraph spawn_tree {"))
+	assert.Contains(t, buf.String(), fmt.Sprintf("n%d -> n%d", edge.Parent, edge.Child))
+}
+
+func TestWakeGraph(t *testing.T) {
+	data := collectTrace(t, func() {
+		items := make(chan int)
+		done := make(chan struct{})
+		go wakeConsumer(items, done)
+		go wakeProducer(items)
+		<-done
+	})
+
+	graph := processTrace(t, data).WakeGraph()
+	var edge *object.WakeEdge
+	for i := range graph.Edges {
+		waker, wakee := graph.Nodes[graph.Edges[i].Waker], graph.Nodes[graph.Edges[i].Wakee]
+		if strings.HasSuffix(waker.Function, ".wakeProducer") && strings.HasSuffix(wakee.Function, ".wakeConsumer") {
+			edge = &graph.Edges[i]
+		}
+	}
+	require.NotNil(t, edge)
+	assert.GreaterOrEqual(t, edge.Count, int64(10))
+	assert.GreaterOrEqual(t, edge.MaxWait, edge.MeanWait)
+	assert.Positive(t, edge.MeanWait)
+	assert.GreaterOrEqual(t, edge.MaxLatency, edge.MeanLatency)
+	assert.GreaterOrEqual(t, graph.Nodes[edge.Waker].Wakes, edge.Count)
+	assert.GreaterOrEqual(t, graph.Nodes[edge.Wakee].Woken, edge.Count)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteWakeGraphDOT(&buf, graph))
+	assert.True(t, strings.HasPrefix(buf.String(), "digraph wake_graph {"))
+	assert.Contains(t, buf.String(), fmt.Sprintf("n%d -> n%d", edge.Waker, edge.Wakee))
+}
+
+func TestWakeAcrossGenerations(t *testing.T) {
+	release := make(chan struct{})
+	data := collectTrace(t, func() {
+		go generationWaiter(release)
+		time.Sleep(1200 * time.Millisecond)
+		close(release)
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	graph := processTrace(t, data).WakeGraph()
+	var edge *object.WakeEdge
+	for i := range graph.Edges {
+		if strings.HasSuffix(graph.Nodes[graph.Edges[i].Wakee].Function, ".generationWaiter") {
+			edge = &graph.Edges[i]
+		}
+	}
+	require.NotNil(t, edge)
+	assert.GreaterOrEqual(t, edge.MaxWait, time.Second)
+	assert.Less(t, edge.MaxLatency, time.Second)
+}
+
+func wakeProducer(items chan int) {
+	for i := range 20 {
+		time.Sleep(100 * time.Microsecond)
+		items <- i
+	}
+	close(items)
+}
+
+func wakeConsumer(items chan int, done chan struct{}) {
+	for range items {
+	}
+	close(done)
+}
+
+func fanOutHandler(wg *sync.WaitGroup) {
+	defer wg.Done()
+	var children sync.WaitGroup
+	for range 5 {
+		children.Add(1)
+		go fanOutChild(&children)
+	}
+	children.Wait()
+}
+
+func fanOutChild(wg *sync.WaitGroup) {
+	wg.Done()
+}
+
+func timelineWorker(done chan struct{}) {
+	spin(time.Millisecond)
+	time.Sleep(time.Millisecond)
+	spin(time.Millisecond)
+	close(done)
+}
+
+// findGoroutine returns an id of a living or terminated goroutine having the function in its start stack
+func findGoroutine(tb testing.TB, tp *TraceProcess, function string) expTrace.GoID {
+	tb.Helper()
+
+	for _, m := range []map[expTrace.GoID]*goroutineStat{tp.livingStats, tp.terminatedStats} {
+		for gID, stat := range m {
+			if strings.Contains(tp.stacks.rendered(stat.transitionStack), function) {
+				return gID
+			}
+		}
+	}
+	require.Fail(tb, "goroutine not found", function)
+	return 0
+}
+
+func pingReceiver(ping, release chan struct{}) {
+	for range 20 {
+		<-ping
+	}
+	<-release
+}
+
+func execDurations(top []object.TopGoroutine) []time.Duration {
+	ret := make([]time.Duration, 0, len(top))
+	for _, g := range top {
+		ret = append(ret, g.ExecDuration)
+	}
+	return ret
+}
+
+func spawner(wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		close(done)
+	}()
+	<-done
+	wg.Done()
+}
+
+func leakingWorker(release chan struct{}) {
+	<-release
+}
+
+// readStream feeds the trace process with data as a single stream of its source
+func readStream(tb testing.TB, tp *TraceProcess, data []byte) {
+	tb.Helper()
+
+	r, err := expTrace.NewReader(bytes.NewReader(data))
+	require.NoError(tb, err)
+	require.ErrorIs(tb, tp.readStream(context.Background(), r), io.EOF)
+}
+
+// collectTrace runs workload while the execution tracer is on and returns the collected trace
+func collectTrace(tb testing.TB, workload func()) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(tb, trace.Start(&buf))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workload()
+	}()
+	wg.Wait()
+	trace.Stop()
+
+	return buf.Bytes()
+}
+
+// processTrace creates a trace process and feeds it all events from data
+func processTrace(tb testing.TB, data []byte, opts ...Option) *TraceProcess {
+	tb.Helper()
+
+	tp, err := NewTraceProcessor("test", opts...)
+	require.NoError(tb, err)
+	r, err := expTrace.NewReader(bytes.NewReader(data))
+	require.NoError(tb, err)
+	for {
+		ev, err := r.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(tb, err)
+		tp.processEvent(&ev)
+	}
+
+	return tp
+}
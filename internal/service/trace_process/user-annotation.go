@@ -0,0 +1,233 @@
+package trace_process
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+const (
+	// defaultLogEntries is a maximum number of user log entries kept
+	defaultLogEntries = 10000
+	// defaultActiveTasks is a maximum number of tasks waiting for their end, it protects from tasks which never end
+	defaultActiveTasks = 100000
+)
+
+type (
+	// annotationStat contains data produced by runtime/trace tasks, regions and logs
+	annotationStat struct {
+		activeTasks map[trace.TaskID]*userTask
+		taskTypes   map[string]*taskTypeStat
+		logs        ring[object.LogEntry]
+	}
+
+	userTask struct {
+		typ   string
+		start trace.Time
+	}
+
+	taskTypeStat struct {
+		typ       string
+		completed int64
+		active    int
+		latency   windowedHistogram
+		regions   map[string]*object.RegionStat
+	}
+
+	// userRegion is a region which has begun but not ended yet
+	userRegion struct {
+		typ      string
+		taskType string
+		start    trace.Time
+		stat     object.RegionStat
+	}
+)
+
+func newAnnotationStat() annotationStat {
+	return annotationStat{
+		activeTasks: make(map[trace.TaskID]*userTask),
+		taskTypes:   make(map[string]*taskTypeStat),
+		logs:        newRing[object.LogEntry](defaultLogEntries),
+	}
+}
+
+// Tasks returns statistics of user tasks by task types. Latencies are calculated within the window ending at the last
+// event, if window is not positive all collected data is used
+func (tip *TraceProcess) Tasks(window time.Duration) []object.TaskStat {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	ret := make([]object.TaskStat, 0, len(tip.annotations.taskTypes))
+	for _, tt := range tip.annotations.taskTypes {
+		latency := tt.latency.histogram(tip.cfg.histograms, tip.lastEventTime, window)
+		item := object.TaskStat{
+			Type:      tt.typ,
+			Completed: tt.completed,
+			Active:    tt.active,
+			Latency:   latency.convert(),
+			Regions:   make([]object.RegionStat, 0, len(tt.regions)),
+		}
+		for _, region := range tt.regions {
+			item.Regions = append(item.Regions, *region)
+		}
+		slices.SortFunc(item.Regions, func(a, b object.RegionStat) int {
+			return cmp.Compare(b.Duration, a.Duration)
+		})
+		ret = append(ret, item)
+	}
+	slices.SortFunc(ret, func(a, b object.TaskStat) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+
+	return ret
+}
+
+// Logs returns the latest user log entries of the given category whose messages contain the given substring. Empty
+// category and substring match any entry. If limit is positive, at most limit newest entries are returned
+func (tip *TraceProcess) Logs(category, contains string, limit int) []object.LogEntry {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	var ret []object.LogEntry
+	for entry := range tip.annotations.logs.all() {
+		if category != "" && entry.Category != category {
+			continue
+		}
+		if contains != "" && !strings.Contains(entry.Message, contains) {
+			continue
+		}
+		ret = append(ret, entry)
+	}
+	if limit > 0 && len(ret) > limit {
+		ret = ret[len(ret)-limit:]
+	}
+
+	return ret
+}
+
+func (tip *TraceProcess) processTaskEvent(ev *trace.Event) {
+	as := &tip.annotations
+	task := ev.Task()
+	now := tip.eventTime(ev)
+
+	if ev.Kind() == trace.EventTaskBegin {
+		if len(as.activeTasks) >= defaultActiveTasks {
+			return
+		}
+		as.activeTasks[task.ID] = &userTask{typ: task.Type, start: now}
+		as.taskType(task.Type).active++
+		return
+	}
+
+	active, ok := as.activeTasks[task.ID]
+	if !ok {
+		return
+	}
+	delete(as.activeTasks, task.ID)
+	tt := as.taskType(active.typ)
+	tt.active--
+	tt.completed++
+	tt.latency.add(tip.cfg.histograms, now, now.Sub(active.start))
+}
+
+func (tip *TraceProcess) processRegionEvent(ev *trace.Event) {
+	stat, ok := tip.livingStats[ev.Goroutine()]
+	if !ok {
+		return
+	}
+
+	region := ev.Region()
+	now := tip.eventTime(ev)
+	if ev.Kind() == trace.EventRegionBegin {
+		var taskType string
+		if task, ok := tip.annotations.activeTasks[region.Task]; ok {
+			taskType = task.typ
+		}
+		stat.regions = append(stat.regions, &userRegion{typ: region.Type, taskType: taskType, start: now})
+		return
+	}
+
+	// Regions are strictly nested within a goroutine, but the beginning of the region might not be in the trace
+	idx := len(stat.regions) - 1
+	for idx >= 0 && stat.regions[idx].typ != region.Type {
+		idx--
+	}
+	if idx == -1 {
+		return
+	}
+
+	addRegionsDuration(stat.regions[idx:], stat.state, stat.lastTransition, now)
+	for _, ended := range stat.regions[idx:] {
+		ended.stat.Count = 1
+		ended.stat.Duration = now.Sub(ended.start)
+		tip.annotations.addRegion(ended)
+	}
+	stat.regions = stat.regions[:idx]
+}
+
+func (tip *TraceProcess) processLogEvent(ev *trace.Event) {
+	l := ev.Log()
+	entry := object.LogEntry{
+		Time:        tip.eventTime(ev),
+		TaskID:      l.Task,
+		GoroutineID: ev.Goroutine(),
+		Category:    l.Category,
+		Message:     l.Message,
+	}
+	if task, ok := tip.annotations.activeTasks[l.Task]; ok {
+		entry.TaskType = task.typ
+	}
+	tip.annotations.logs.add(entry)
+}
+
+func (as *annotationStat) taskType(typ string) *taskTypeStat {
+	tt, ok := as.taskTypes[typ]
+	if !ok {
+		tt = &taskTypeStat{typ: typ, regions: make(map[string]*object.RegionStat)}
+		as.taskTypes[typ] = tt
+	}
+
+	return tt
+}
+
+func (as *annotationStat) addRegion(region *userRegion) {
+	tt := as.taskType(region.taskType)
+	stat, ok := tt.regions[region.typ]
+	if !ok {
+		stat = &object.RegionStat{Type: region.typ}
+		tt.regions[region.typ] = stat
+	}
+
+	stat.Count += region.stat.Count
+	stat.Duration += region.stat.Duration
+	stat.RunningDuration += region.stat.RunningDuration
+	stat.WaitingDuration += region.stat.WaitingDuration
+	stat.RunnableDuration += region.stat.RunnableDuration
+	stat.SyscallDuration += region.stat.SyscallDuration
+}
+
+// addRegionsDuration adds time spent by a goroutine in the "from" state since its last transition to the regions
+func addRegionsDuration(regions []*userRegion, from trace.GoState, lastTransition, now trace.Time) {
+	for _, region := range regions {
+		elapsed := now.Sub(max(lastTransition, region.start))
+		if elapsed <= 0 {
+			continue
+		}
+
+		switch from {
+		case trace.GoRunning:
+			region.stat.RunningDuration += elapsed
+		case trace.GoWaiting:
+			region.stat.WaitingDuration += elapsed
+		case trace.GoRunnable:
+			region.stat.RunnableDuration += elapsed
+		case trace.GoSyscall:
+			region.stat.SyscallDuration += elapsed
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package trace_process
+
+import (
+	"maps"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+// Wait reasons which are not reported by the runtime as is. Other reasons like "chan receive", "select", "sleep" or
+// "network" are used as they come in trace events
+const (
+	waitReasonSyscall       = "syscall"
+	waitReasonUnknown       = "unknown"
+	waitReasonSync          = "sync"
+	waitReasonMutex         = "sync.Mutex"
+	waitReasonRWMutex       = "sync.RWMutex"
+	waitReasonWaitGroup     = "sync.WaitGroup"
+	waitReasonCond          = "sync.Cond"
+	waitReasonGCAssist      = "GC assist"
+	runtimeReasonCondWait   = "sync.(*Cond).Wait"
+	runtimeReasonMarkAssist = "GC mark assist wait for work"
+)
+
+// syncPrimitives maps frame function prefixes to wait reasons, it is used to find out what kind of sync primitive
+// a goroutine is blocked on because the runtime reports all of them as "sync"
+var syncPrimitives = []struct {
+	funcPrefix string
+	reason     string
+}{
+	{"sync.(*Mutex).", waitReasonMutex},
+	{"sync.(*RWMutex).", waitReasonRWMutex},
+	{"sync.(*WaitGroup).", waitReasonWaitGroup},
+}
+
+// waitReason returns a reason why a goroutine switched to the "to" state. An empty string is returned for states
+// other than Waiting and Syscall
+func waitReason(st trace.StateTransition, to trace.GoState) string {
+	switch to {
+	case trace.GoSyscall:
+		return waitReasonSyscall
+	case trace.GoWaiting:
+	default:
+		return ""
+	}
+
+	switch st.Reason {
+	case "":
+		return waitReasonUnknown
+	case runtimeReasonCondWait:
+		return waitReasonCond
+	case runtimeReasonMarkAssist:
+		return waitReasonGCAssist
+	case waitReasonSync:
+		// The outermost sync frame is taken because, for example, RWMutex uses Mutex under the hood
+		reason := waitReasonSync
+		for frame := range st.Stack.Frames() {
+			for _, primitive := range syncPrimitives {
+				if strings.HasPrefix(frame.Func, primitive.funcPrefix) {
+					reason = primitive.reason
+				}
+			}
+		}
+		return reason
+	default:
+		return st.Reason
+	}
+}
+
+// addStateDuration adds time spent by the goroutine in the "from" state since the last transition
+func (gs *goroutineStat) addStateDuration(from trace.GoState, now trace.Time) {
+	if gs.lastTransition == 0 {
+		return
+	}
+
+	elapsed := now.Sub(gs.lastTransition)
+	switch from {
+	case trace.GoRunnable:
+		gs.runnableDuration += elapsed
+	case trace.GoWaiting, trace.GoSyscall:
+		if gs.waitDurations == nil {
+			gs.waitDurations = make(map[string]time.Duration)
+		}
+		gs.waitDurations[gs.waitReason] += elapsed
+	}
+}
+
+// waitDurationsAt returns time spent in every wait reason and in the Runnable state including the current state
+// duration up to now
+func (gs *goroutineStat) waitDurationsAt(now trace.Time) (map[string]time.Duration, time.Duration) {
+	waits := maps.Clone(gs.waitDurations)
+	runnable := gs.runnableDuration
+	if gs.lastTransition == 0 || now < gs.lastTransition {
+		return waits, runnable
+	}
+
+	elapsed := now.Sub(gs.lastTransition)
+	switch gs.state {
+	case trace.GoRunnable:
+		runnable += elapsed
+	case trace.GoWaiting, trace.GoSyscall:
+		if waits == nil {
+			waits = make(map[string]time.Duration)
+		}
+		waits[gs.waitReason] += elapsed
+	}
+
+	return waits, runnable
+}
@@ -0,0 +1,151 @@
+package trace_process
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/maratig/trace_analyzer/api/object"
+)
+
+// runtimeWaker is a function name of the node standing for wake-ups without a running goroutine
+const runtimeWaker = "runtime"
+
+type (
+	// wakeEdgeKey links groups of waking and woken goroutines, waker is nil for wake-ups done by the runtime
+	wakeEdgeKey struct {
+		waker, wakee *stackGroup
+	}
+
+	// wakeEdge accumulates wake-ups of goroutines of the wakee group by goroutines of the waker group. Latency is
+	// accumulated for wake-ups which have been followed by running
+	wakeEdge struct {
+		key          wakeEdgeKey
+		count        int64
+		totalWait    time.Duration
+		maxWait      time.Duration
+		runs         int64
+		totalLatency time.Duration
+		maxLatency   time.Duration
+	}
+)
+
+// WakeGraph returns goroutine groups linked by waking goroutines up. Edges are sorted by the number of wake-ups in
+// descending order
+func (tip *TraceProcess) WakeGraph() object.WakeGraph {
+	tip.mx.RLock()
+	defer tip.mx.RUnlock()
+
+	edges := make([]*wakeEdge, 0, len(tip.wakeEdges))
+	for _, edge := range tip.wakeEdges {
+		edges = append(edges, edge)
+	}
+	slices.SortFunc(edges, func(a, b *wakeEdge) int {
+		return cmp.Or(
+			cmp.Compare(b.count, a.count),
+			cmp.Compare(wakeGroupStack(a.key.waker), wakeGroupStack(b.key.waker)),
+			cmp.Compare(a.key.wakee.key.transitionStack, b.key.wakee.key.transitionStack),
+		)
+	})
+
+	var ret object.WakeGraph
+	ids := make(map[*stackGroup]int)
+	nodeID := func(group *stackGroup) int {
+		id, ok := ids[group]
+		if !ok {
+			id = len(ret.Nodes)
+			ids[group] = id
+			node := object.WakeNode{ID: id, Function: runtimeWaker}
+			if group != nil {
+				node.Function = tip.stacks.topFunction(group.key.transitionStack)
+				node.Stack = tip.stacks.rendered(group.key.stack)
+				node.TransitionStack = tip.stacks.rendered(group.key.transitionStack)
+			}
+			ret.Nodes = append(ret.Nodes, node)
+		}
+		return id
+	}
+
+	for _, edge := range edges {
+		waker, wakee := nodeID(edge.key.waker), nodeID(edge.key.wakee)
+		ret.Nodes[waker].Wakes += edge.count
+		ret.Nodes[wakee].Woken += edge.count
+		ret.Edges = append(ret.Edges, object.WakeEdge{
+			Waker:       waker,
+			Wakee:       wakee,
+			Count:       edge.count,
+			MeanWait:    edge.totalWait / time.Duration(edge.count),
+			MaxWait:     edge.maxWait,
+			MeanLatency: edge.totalLatency / time.Duration(max(edge.runs, 1)),
+			MaxLatency:  edge.maxLatency,
+		})
+	}
+
+	return ret
+}
+
+// WriteWakeGraphDOT writes the wake graph in Graphviz DOT format
+func WriteWakeGraphDOT(w io.Writer, graph object.WakeGraph) error {
+	var sb strings.Builder
+	sb.WriteString("digraph wake_graph {\n\tnode [shape=box];\n")
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%s\nwakes: %d, woken: %d", node.Function, node.Wakes, node.Woken)
+		fmt.Fprintf(&sb, "\tn%d [label=%s];\n", node.ID, dotQuote(label))
+	}
+	for _, edge := range graph.Edges {
+		label := fmt.Sprintf("%d\nwait: %s, latency: %s", edge.Count, edge.MeanWait, edge.MeanLatency)
+		fmt.Fprintf(&sb, "\tn%d -> n%d [label=%s];\n", edge.Waker, edge.Wakee, dotQuote(label))
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// addWake counts the wake-up of the goroutine blocked since its last transition by the goroutine with the waker id
+func (tip *TraceProcess) addWake(wakerID trace.GoID, wakee *goroutineStat, now trace.Time) {
+	key := wakeEdgeKey{wakee: wakee.group}
+	if waker, ok := tip.livingStats[wakerID]; ok {
+		key.waker = waker.group
+	}
+	edge, ok := tip.wakeEdges[key]
+	if !ok {
+		edge = &wakeEdge{key: key}
+		tip.wakeEdges[key] = edge
+	}
+
+	wait := now.Sub(wakee.lastTransition)
+	edge.count++
+	edge.totalWait += wait
+	edge.maxWait = max(edge.maxWait, wait)
+	wakee.wokenBy = edge
+}
+
+// leaveRunnable adds the latency of the goroutine woken up since its last transition to its wake edge if it starts
+// running now
+func (gs *goroutineStat) leaveRunnable(to trace.GoState, now trace.Time) {
+	if gs.wokenBy == nil {
+		return
+	}
+
+	if to == trace.GoRunning {
+		latency := now.Sub(gs.lastTransition)
+		gs.wokenBy.runs++
+		gs.wokenBy.totalLatency += latency
+		gs.wokenBy.maxLatency = max(gs.wokenBy.maxLatency, latency)
+	}
+	gs.wokenBy = nil
+}
+
+// wakeGroupStack returns a stack a waker group is ordered by, the runtime goes first
+func wakeGroupStack(group *stackGroup) stackID {
+	if group == nil {
+		return noStack
+	}
+	return group.key.transitionStack
+}